@@ -0,0 +1,167 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// EnvCredentials points client libraries at a credentials file, taking
+// precedence over the file written by gcloud auth application-default login
+const EnvCredentials = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// tokenInfoURL resolves an access token to the identity it was issued to
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// adcFile holds the fields of a credentials file that identify it
+type adcFile struct {
+	Type                           string `json:"type"`
+	Account                        string `json:"account"`
+	ClientEmail                    string `json:"client_email"`
+	QuotaProjectID                 string `json:"quota_project_id"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+}
+
+// ReadADC reads the credentials file that Application Default Credentials
+// resolve to, with env taking precedence over the process environment. The
+// identity of user credentials is not always recorded in the file;
+// LookupADCAccount finds it.
+func ReadADC(env gcloudconfig.Env) (types.ADC, error) {
+	adc := types.ADC{Path: env.Getenv(EnvCredentials), FromEnv: true}
+	if adc.Path == "" {
+		dir, err := gcloudconfig.Dir()
+		if err != nil {
+			return adc, err
+		}
+		adc = types.ADC{Path: filepath.Join(dir, "application_default_credentials.json")}
+	}
+
+	data, err := os.ReadFile(adc.Path)
+	if errors.Is(err, fs.ErrNotExist) && !adc.FromEnv {
+		return adc, nil
+	}
+	if err != nil {
+		return adc, err
+	}
+
+	var file adcFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return adc, fmt.Errorf("failed to parse %s: %w", adc.Path, err)
+	}
+	adc.Type = file.Type
+	adc.QuotaProject = file.QuotaProjectID
+	switch {
+	case file.ClientEmail != "":
+		adc.Account = file.ClientEmail
+	case file.ServiceAccountImpersonationURL != "":
+		// .../serviceAccounts/<email>:generateAccessToken
+		name := file.ServiceAccountImpersonationURL[strings.LastIndex(file.ServiceAccountImpersonationURL, "/")+1:]
+		adc.Account, _, _ = strings.Cut(name, ":")
+	default:
+		adc.Account = file.Account
+	}
+	return adc, nil
+}
+
+// GetADC retrieves the Application Default Credentials from their file. It
+// makes no gcloud or network call, so it is cheap enough for every refresh.
+func GetADC(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		adc, err := ReadADC(r.Env())
+		return types.ADCMsg{ADC: adc, Err: err}
+	}
+}
+
+// LookupADCAccount finds the user behind Application Default Credentials
+// whose file does not record it, by asking the token info endpoint who an
+// access token was issued to
+func LookupADCAccount(r Runner, client *http.Client, path string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		account, err := adcAccount(ctx, r, client)
+		return types.ADCAccountMsg{Path: path, Account: account, Err: err}
+	}
+}
+
+// adcAccount returns the email address of the user behind the Application
+// Default Credentials. The token is sent in the request body so that it
+// does not end up in proxy or server logs.
+func adcAccount(ctx context.Context, r Runner, client *http.Client) (string, error) {
+	output, err := r.Output(ctx, "auth", "application-default", "print-access-token")
+	if err != nil {
+		return "", err
+	}
+	// Warnings may precede the token in the combined output
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("no access token")
+	}
+
+	form := url.Values{"access_token": {fields[len(fields)-1]}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenInfoURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token info: %s", resp.Status)
+	}
+
+	var info struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", err
+	}
+	return info.Email, nil
+}
+
+// ADCLogin runs gcloud auth application-default login in the terminal
+func ADCLogin(r Runner, flags ...string) tea.Cmd {
+	return interactive(r, types.ResultADCChanged, append([]string{"auth", "application-default", "login"}, flags...))
+}
+
+// RevokeADC revokes the Application Default Credentials and deletes their file
+func RevokeADC(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		if err := runSteps(ctx, r, []string{"auth", "application-default", "revoke", "--quiet"}); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultADCChanged}
+	}
+}
+
+// SetQuotaProject sets the project billed for API calls made with the
+// Application Default Credentials
+func SetQuotaProject(r Runner, projectID string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		if err := runSteps(ctx, r, []string{"auth", "application-default", "set-quota-project", projectID}); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultADCChanged}
+	}
+}
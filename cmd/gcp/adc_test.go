@@ -0,0 +1,68 @@
+package gcp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestReadADC(t *testing.T) {
+	for _, tc := range []struct {
+		name, contents string
+		want           types.ADC
+	}{
+		{
+			"user", `{"type":"authorized_user","account":"alice@example.com","quota_project_id":"alpha-123"}`,
+			types.ADC{Type: "authorized_user", Account: "alice@example.com", QuotaProject: "alpha-123"},
+		},
+		{
+			"user without account", `{"type":"authorized_user","client_id":"123"}`,
+			types.ADC{Type: "authorized_user"},
+		},
+		{
+			"service account", `{"type":"service_account","client_email":"ci@alpha-123.iam.gserviceaccount.com"}`,
+			types.ADC{Type: "service_account", Account: "ci@alpha-123.iam.gserviceaccount.com"},
+		},
+		{
+			"impersonation", `{"type":"impersonated_service_account","service_account_impersonation_url":` +
+				`"https://iamcredentials.googleapis.com/v1/projects/-/serviceAccounts/deployer@beta-456.iam.gserviceaccount.com:generateAccessToken"}`,
+			types.ADC{Type: "impersonated_service_account", Account: "deployer@beta-456.iam.gserviceaccount.com"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("CLOUDSDK_CONFIG", dir)
+			path := filepath.Join(dir, "application_default_credentials.json")
+			if err := os.WriteFile(path, []byte(tc.contents), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			adc, err := ReadADC(gcloudconfig.Env{EnvCredentials: ""})
+			tc.want.Path = path
+			if err != nil || adc != tc.want {
+				t.Errorf("Expected %+v, got %+v and %v", tc.want, adc, err)
+			}
+		})
+	}
+}
+
+func TestReadADCMissing(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CLOUDSDK_CONFIG", dir)
+
+	// Without a file written by gcloud there are no credentials
+	adc, err := ReadADC(gcloudconfig.Env{EnvCredentials: ""})
+	if err != nil || adc.Type != "" || adc.Path != filepath.Join(dir, "application_default_credentials.json") {
+		t.Errorf("Expected no credentials at gcloud's path, got %+v and %v", adc, err)
+	}
+
+	// A file named by the environment must exist
+	missing := filepath.Join(dir, "missing.json")
+	adc, err = ReadADC(gcloudconfig.Env{EnvCredentials: missing})
+	if err == nil || !adc.FromEnv || adc.Path != missing {
+		t.Errorf("Expected an error for the missing file from the environment, got %+v and %v", adc, err)
+	}
+}
@@ -4,12 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"os/exec"
 	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
 	"github.com/mathd/gcp-switcher/types"
 )
 
@@ -19,19 +18,30 @@ const (
 )
 
 // CheckGcloud checks if gcloud CLI is installed
-func CheckGcloud() tea.Msg {
-	_, err := exec.LookPath("gcloud")
-	return types.GcloudCheckMsg{Available: err == nil}
+func CheckGcloud(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		return types.GcloudCheckMsg{Available: r.Available()}
+	}
+}
+
+// Resolve reads the effective properties from the configuration files, as
+// gcloud sees them when run by r
+func Resolve(r Runner) (gcloudconfig.Properties, error) {
+	return gcloudconfig.ResolveWith(r.Env())
 }
 
-// GetActiveAccount retrieves the currently active GCP account
-func GetActiveAccount() tea.Cmd {
+// GetActiveAccount retrieves the currently active GCP account. The account is
+// read from the configuration files when possible, falling back to gcloud.
+func GetActiveAccount(r Runner) tea.Cmd {
 	return func() tea.Msg {
+		if props, err := Resolve(r); err == nil {
+			return types.ActiveAccountMsg{Account: props.Account}
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "gcloud", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)")
-		output, err := cmd.CombinedOutput()
+		output, err := r.Output(ctx, "auth", "list", "--filter=status:ACTIVE", "--format=value(account)")
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
@@ -45,14 +55,18 @@ func GetActiveAccount() tea.Cmd {
 	}
 }
 
-// GetActiveProject retrieves the currently active GCP project
-func GetActiveProject() tea.Cmd {
+// GetActiveProject retrieves the currently active GCP project. The project is
+// read from the configuration files when possible, falling back to gcloud.
+func GetActiveProject(r Runner) tea.Cmd {
 	return func() tea.Msg {
+		if props, err := Resolve(r); err == nil {
+			return types.ActiveProjectMsg{Project: props.Project}
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "gcloud", "config", "get-value", "project")
-		output, err := cmd.CombinedOutput()
+		output, err := r.Output(ctx, "config", "get-value", "project")
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
@@ -67,13 +81,12 @@ func GetActiveProject() tea.Cmd {
 }
 
 // GetAllAccounts retrieves all configured GCP accounts
-func GetAllAccounts() tea.Cmd {
+func GetAllAccounts(r Runner) tea.Cmd {
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "gcloud", "auth", "list", "--format=json")
-		output, err := cmd.CombinedOutput()
+		output, err := r.Output(ctx, "auth", "list", "--format=json")
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
@@ -92,13 +105,12 @@ func GetAllAccounts() tea.Cmd {
 }
 
 // GetSimpleProjects retrieves all accessible GCP projects
-func GetSimpleProjects() tea.Cmd {
+func GetSimpleProjects(r Runner) tea.Cmd {
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "gcloud", "projects", "list", "--format=json")
-		output, err := cmd.CombinedOutput()
+		output, err := r.Output(ctx, "projects", "list", "--format=json")
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
@@ -117,24 +129,17 @@ func GetSimpleProjects() tea.Cmd {
 }
 
 // SwitchAccount switches the active GCP account
-func SwitchAccount(account string) tea.Cmd {
+func SwitchAccount(r Runner, account string) tea.Cmd {
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
 		defer cancel()
 
 		// First, verify the account exists in the authenticated accounts list
-		checkCmd := exec.CommandContext(ctx, "gcloud", "auth", "list", "--filter=account:"+account, "--format=value(account)")
-		checkOutput, checkErr := checkCmd.CombinedOutput()
-
-		if checkErr != nil || strings.TrimSpace(string(checkOutput)) == "" {
-			return types.OperationResultMsg{
-				Success: false,
-				Err: fmt.Errorf("account %s is not authenticated\n\nPlease run 'gcloud auth login %s' to authenticate this account first.", account, account),
-			}
+		if err := checkAuthenticated(ctx, r, account); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
 		}
 
-		cmd := exec.CommandContext(ctx, "gcloud", "config", "set", "account", account)
-		output, err := cmd.CombinedOutput()
+		output, err := r.Output(ctx, "config", "set", "account", account)
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
@@ -149,66 +154,126 @@ func SwitchAccount(account string) tea.Cmd {
 			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to account %s: %v\n\nPlease ensure the account is authenticated. Run 'gcloud auth login %s' if needed.", account, err, account)}
 		}
 
-		return types.OperationResultMsg{Success: true, Message: "ACCOUNT_SWITCHED"}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultAccountSwitched}
+	}
+}
+
+// checkAuthenticated verifies that an account has credentials in gcloud
+func checkAuthenticated(ctx context.Context, r Runner, account string) error {
+	output, err := r.Output(ctx, "auth", "list", "--filter=account:"+account, "--format=value(account)")
+	if err != nil || strings.TrimSpace(string(output)) == "" {
+		return fmt.Errorf("account %s is not authenticated\n\nPlease run 'gcloud auth login %s' to authenticate this account first.", account, account)
 	}
+	return nil
 }
 
-// LoginNewAccount initiates login for a new GCP account
-func LoginNewAccount() tea.Cmd {
+// LoginOptions tunes the interactive gcloud login flows
+type LoginOptions struct {
+	// Flags are passed to every login, e.g. --no-browser for remote machines
+	Flags []string
+	// SkipADC skips the Application Default Credentials login
+	SkipADC bool
+}
+
+// LoginNewAccount logs in to a new account, then to Application Default
+// Credentials unless skipped
+func LoginNewAccount(r Runner, options LoginOptions) tea.Cmd {
+	commands := [][]string{append([]string{"auth", "login"}, options.Flags...)}
+	if !options.SkipADC {
+		commands = append(commands, append([]string{"auth", "application-default", "login"}, options.Flags...))
+	}
+	return interactive(r, types.ResultLoggedIn, commands...)
+}
+
+// interactive hands the terminal to each gcloud command in turn while the
+// interface is suspended. No deadline applies since the user completes these
+// flows in a browser, possibly on another machine.
+func interactive(r Runner, kind types.ResultKind, commands ...[]string) tea.Cmd {
+	return r.Interactive(func(err error) tea.Msg {
+		if err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		return types.OperationResultMsg{Success: true, Kind: kind}
+	}, commands...)
+}
+
+// SwitchProject switches the active GCP project
+func SwitchProject(r Runner, projectID string) tea.Cmd {
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 		defer cancel()
 
-		loginCmd := exec.CommandContext(ctx, "gcloud", "auth", "login")
-		loginCmd.Stdin = os.Stdin
-		loginCmd.Stdout = os.Stdout
-		loginCmd.Stderr = os.Stderr
-		err := loginCmd.Run()
+		output, err := r.Output(ctx, "config", "set", "project", projectID)
+
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
-				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud auth login")}
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud config set project %s", projectID)}
 			}
-			return types.OperationResultMsg{Success: false, Err: err}
+
+			// Include the actual command output in the error message
+			errorOutput := strings.TrimSpace(string(output))
+			if errorOutput != "" {
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to project %s:\n%s\n\nPlease ensure you have access to this project and that it exists.", projectID, errorOutput)}
+			}
+			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to project %s: %v\n\nPlease ensure you have access to this project and that it exists.", projectID, err)}
 		}
 
-		adcCmd := exec.CommandContext(ctx, "gcloud", "auth", "application-default", "login")
-		adcCmd.Stdin = os.Stdin
-		adcCmd.Stdout = os.Stdout
-		adcCmd.Stderr = os.Stderr
-		err = adcCmd.Run()
+		return types.OperationResultMsg{Success: true, Kind: types.ResultProjectSwitched}
+	}
+}
+
+// GetProperty retrieves a gcloud property such as compute/region. The region
+// and zone are read from the configuration files when possible.
+func GetProperty(r Runner, property string) tea.Cmd {
+	return func() tea.Msg {
+		if props, err := Resolve(r); err == nil {
+			switch property {
+			case PropertyRegion:
+				return types.PropertyMsg{Property: property, Value: props.Region}
+			case PropertyZone:
+				return types.PropertyMsg{Property: property, Value: props.Zone}
+			case PropertyImpersonation:
+				return types.PropertyMsg{Property: property, Value: props.ImpersonateServiceAccount}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		output, err := r.Output(ctx, "config", "get-value", property)
+
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
-				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud auth application-default login")}
+				return types.ErrMsg{Err: fmt.Errorf("command timed out: gcloud config get-value %s", property)}
 			}
-			return types.OperationResultMsg{Success: false, Err: err}
+			return types.ErrMsg{Err: err}
 		}
 
-		return types.OperationResultMsg{Success: true}
+		return types.PropertyMsg{Property: property, Value: strings.TrimSpace(string(output))}
 	}
 }
 
-// SwitchProject switches the active GCP project
-func SwitchProject(projectID string) tea.Cmd {
+// SetProperty sets a gcloud property such as compute/region
+func SetProperty(r Runner, property, value string) tea.Cmd {
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
 		defer cancel()
 
-		cmd := exec.CommandContext(ctx, "gcloud", "config", "set", "project", projectID)
-		output, err := cmd.CombinedOutput()
+		output, err := r.Output(ctx, "config", "set", property, value)
 
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
-				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud config set project %s", projectID)}
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud config set %s %s", property, value)}
 			}
 
 			// Include the actual command output in the error message
 			errorOutput := strings.TrimSpace(string(output))
 			if errorOutput != "" {
-				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to project %s:\n%s\n\nPlease ensure you have access to this project and that it exists.", projectID, errorOutput)}
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to set %s to %s:\n%s", property, value, errorOutput)}
 			}
-			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to project %s: %v\n\nPlease ensure you have access to this project and that it exists.", projectID, err)}
+			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to set %s to %s: %v", property, value, err)}
 		}
 
-		return types.OperationResultMsg{Success: true}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultPropertySet}
 	}
 }
@@ -0,0 +1,119 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// GetConfigurations retrieves all named gcloud configurations. They are read
+// from the configuration files when possible, falling back to gcloud.
+func GetConfigurations(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		if configurations, err := readConfigurations(r.Env()); err == nil {
+			return types.ConfigurationListMsg{Configurations: configurations}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		output, err := r.Output(ctx, "config", "configurations", "list", "--format=json")
+
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return types.ErrMsg{Err: fmt.Errorf("command timed out: gcloud config configurations list")}
+			}
+			return types.ErrMsg{Err: err}
+		}
+
+		var configurations []types.Configuration
+		if err := json.Unmarshal(output, &configurations); err != nil {
+			return types.ErrMsg{Err: fmt.Errorf("failed to parse configurations JSON: %w", err)}
+		}
+
+		return types.ConfigurationListMsg{Configurations: configurations}
+	}
+}
+
+// readConfigurations reads every configuration file of the gcloud
+// configuration directory, as gcloud config configurations list reports them
+func readConfigurations(env gcloudconfig.Env) ([]types.Configuration, error) {
+	dir, err := gcloudconfig.Dir()
+	if err != nil {
+		return nil, err
+	}
+	names, err := gcloudconfig.Names(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		// gcloud creates the default configuration on first use
+		return nil, gcloudconfig.ErrNotFound
+	}
+
+	active := gcloudconfig.ActiveNameWith(dir, env)
+	configurations := make([]types.Configuration, len(names))
+	for i, name := range names {
+		config, err := gcloudconfig.Load(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		configuration := types.Configuration{Name: name, IsActive: name == active}
+		configuration.Properties.Core.Account = config.Get("core", "account")
+		configuration.Properties.Core.Project = config.Get("core", "project")
+		configuration.Properties.Compute.Region = config.Get("compute", "region")
+		configuration.Properties.Compute.Zone = config.Get("compute", "zone")
+		configurations[i] = configuration
+	}
+	return configurations, nil
+}
+
+// ActivateConfiguration makes the named configuration the active one
+func ActivateConfiguration(r Runner, name string) tea.Cmd {
+	return configurationCmd(r, "activate", name, "config", "configurations", "activate", name)
+}
+
+// CreateConfiguration creates a new, empty configuration and activates it
+func CreateConfiguration(r Runner, name string) tea.Cmd {
+	return configurationCmd(r, "create", name, "config", "configurations", "create", name)
+}
+
+// RenameConfiguration renames an existing configuration
+func RenameConfiguration(r Runner, name, newName string) tea.Cmd {
+	return configurationCmd(r, "rename", name, "config", "configurations", "rename", name, "--new-name="+newName)
+}
+
+// DeleteConfiguration deletes a configuration. The active configuration cannot be deleted.
+func DeleteConfiguration(r Runner, name string) tea.Cmd {
+	return configurationCmd(r, "delete", name, "config", "configurations", "delete", name, "--quiet")
+}
+
+// configurationCmd runs a configuration management command and reports the result
+func configurationCmd(r Runner, verb, name string, args ...string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		output, err := r.Output(ctx, args...)
+
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud config configurations %s %s", verb, name)}
+			}
+
+			// Include the actual command output in the error message
+			errorOutput := strings.TrimSpace(string(output))
+			if errorOutput != "" {
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to %s configuration %s:\n%s", verb, name, errorOutput)}
+			}
+			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to %s configuration %s: %v", verb, name, err)}
+		}
+
+		return types.OperationResultMsg{Success: true, Kind: types.ResultConfigurationChanged}
+	}
+}
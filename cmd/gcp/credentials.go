@@ -0,0 +1,147 @@
+package gcp
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// GetCredentials lists the accounts gcloud holds credentials for, grouped by
+// type: user accounts, service accounts, then external accounts
+func GetCredentials(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		var accounts []types.Account
+		if err := listResources(ctx, r, &accounts, "auth", "list", "--format=json"); err != nil {
+			return types.CredentialListMsg{Err: err}
+		}
+
+		credentials := make([]types.Credential, len(accounts))
+		for i, account := range accounts {
+			credentials[i] = types.Credential{Account: account.Account, Status: account.Status, Type: credentialType(account.Account)}
+		}
+		order := []string{types.CredentialUser, types.CredentialServiceAccount, types.CredentialExternal}
+		slices.SortStableFunc(credentials, func(a, b types.Credential) int {
+			return cmp.Compare(slices.Index(order, a.Type), slices.Index(order, b.Type))
+		})
+		return types.CredentialListMsg{Credentials: credentials}
+	}
+}
+
+// credentialType tells the kind of credentials held for an account. gcloud
+// keeps a copy of each account's credentials in legacy_credentials; when it
+// cannot be read, the account name is telling enough.
+func credentialType(account string) string {
+	if dir, err := gcloudconfig.Dir(); err == nil {
+		if data, err := os.ReadFile(filepath.Join(dir, "legacy_credentials", account, "adc.json")); err == nil {
+			var file adcFile
+			if json.Unmarshal(data, &file) == nil {
+				switch file.Type {
+				case "authorized_user":
+					return types.CredentialUser
+				case "service_account":
+					return types.CredentialServiceAccount
+				case "external_account", "external_account_authorized_user":
+					return types.CredentialExternal
+				}
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(account, "principal://"), strings.HasPrefix(account, "principalSet://"):
+		return types.CredentialExternal
+	case strings.HasSuffix(account, ".gserviceaccount.com"):
+		return types.CredentialServiceAccount
+	default:
+		return types.CredentialUser
+	}
+}
+
+// ReadKeyFile returns the service account a key file belongs to
+func ReadKeyFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var file adcFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return "", fmt.Errorf("%s is not a JSON key file: %w", path, err)
+	}
+	if file.Type != "service_account" || file.ClientEmail == "" {
+		return "", fmt.Errorf("%s is not a service account key file", path)
+	}
+	return file.ClientEmail, nil
+}
+
+// ActivateServiceAccount adds the credentials of a service account key file.
+// gcloud also makes the service account the active account.
+func ActivateServiceAccount(r Runner, keyFile string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		if err := runSteps(ctx, r, []string{"auth", "activate-service-account", "--key-file=" + keyFile}); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultCredentialsChanged}
+	}
+}
+
+// CheckAccountTokens finds the accounts whose credentials can no longer
+// produce an access token, e.g. after a password change or an expired
+// session. The accounts are checked in parallel.
+func CheckAccountTokens(r Runner, accounts []string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		valid := make([]bool, len(accounts))
+		var wg sync.WaitGroup
+		for i, account := range accounts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := r.Output(ctx, "auth", "print-access-token", account)
+				valid[i] = err == nil
+			}()
+		}
+		wg.Wait()
+		if ctx.Err() == context.DeadlineExceeded {
+			return types.AccountCheckMsg{Err: fmt.Errorf("command timed out: gcloud auth print-access-token")}
+		}
+
+		var invalid []string
+		for i, account := range accounts {
+			if !valid[i] {
+				invalid = append(invalid, account)
+			}
+		}
+		return types.AccountCheckMsg{Invalid: invalid}
+	}
+}
+
+// RevokeCredentials revokes the credentials of accounts and removes them from gcloud
+func RevokeCredentials(r Runner, accounts ...string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		if err := runSteps(ctx, r, append([]string{"auth", "revoke"}, accounts...)); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultCredentialsChanged}
+	}
+}
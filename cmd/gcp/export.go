@@ -0,0 +1,75 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// Environment variables gcloud reads in place of its configuration
+const (
+	EnvAccount             = "CLOUDSDK_CORE_ACCOUNT"
+	EnvProject             = "CLOUDSDK_CORE_PROJECT"
+	EnvActiveConfiguration = "CLOUDSDK_ACTIVE_CONFIG_NAME"
+)
+
+// ExportAccount validates an account and returns it as an environment export,
+// leaving gcloud's global configuration untouched
+func ExportAccount(r Runner, account string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		if err := checkAuthenticated(ctx, r, account); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return types.OperationResultMsg{Success: false, Err: fmt.Errorf("command timed out: gcloud auth list --filter=account:%s", account)}
+			}
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+
+		return types.OperationResultMsg{
+			Success: true,
+			Kind:    types.ResultAccountSwitched,
+			Env:     map[string]string{EnvAccount: account},
+		}
+	}
+}
+
+// ExportProject returns a project as an environment export
+func ExportProject(projectID string) tea.Cmd {
+	return func() tea.Msg {
+		return types.OperationResultMsg{
+			Success: true,
+			Kind:    types.ResultProjectSwitched,
+			Env:     map[string]string{EnvProject: projectID},
+		}
+	}
+}
+
+// ExportAccountProject validates an account and returns it along with a
+// project as environment exports
+func ExportAccountProject(r Runner, account, projectID string) tea.Cmd {
+	exportAccount := ExportAccount(r, account)
+	return func() tea.Msg {
+		msg := exportAccount().(types.OperationResultMsg)
+		if !msg.Success {
+			return msg
+		}
+		msg.Kind = types.ResultProjectSwitched
+		msg.Env[EnvProject] = projectID
+		return msg
+	}
+}
+
+// ExportConfiguration returns a configuration name as an environment export
+func ExportConfiguration(name string) tea.Cmd {
+	return func() tea.Msg {
+		return types.OperationResultMsg{
+			Success: true,
+			Kind:    types.ResultConfigurationChanged,
+			Env:     map[string]string{EnvActiveConfiguration: name},
+		}
+	}
+}
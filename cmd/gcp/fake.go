@@ -0,0 +1,154 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// FakeResponse is a scripted result for a single gcloud invocation
+type FakeResponse struct {
+	Output string
+	Err    error
+}
+
+// FakeRunner is an in-memory Runner that replays scripted responses.
+// Invocations that were not scripted fail with an error.
+type FakeRunner struct {
+	// Missing makes Available report that gcloud is not installed
+	Missing bool
+
+	env map[string]string
+	*fakeScript
+}
+
+// fakeScript is shared by a FakeRunner and the runners derived from it with
+// WithEnv, so responses scripted on one are seen by all
+type fakeScript struct {
+	mu        sync.Mutex
+	responses map[string][]FakeResponse
+	last      map[string]FakeResponse
+	calls     [][]string
+	envs      []map[string]string
+}
+
+// NewFakeRunner creates an empty FakeRunner
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{fakeScript: &fakeScript{
+		responses: map[string][]FakeResponse{},
+		last:      map[string]FakeResponse{},
+	}}
+}
+
+// Respond scripts a successful invocation. Responses for the same arguments
+// are queued in order and the last one is repeated once the queue drains.
+func (f *FakeRunner) Respond(output string, args ...string) *FakeRunner {
+	return f.script(FakeResponse{Output: output}, args)
+}
+
+// Fail scripts a failing invocation with the given output
+func (f *FakeRunner) Fail(err error, output string, args ...string) *FakeRunner {
+	return f.script(FakeResponse{Output: output, Err: err}, args)
+}
+
+func (f *FakeRunner) script(resp FakeResponse, args []string) *FakeRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeKey(args)
+	f.responses[key] = append(f.responses[key], resp)
+	return f
+}
+
+// Calls returns the arguments of every invocation so far
+func (f *FakeRunner) Calls() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := make([][]string, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// Called reports whether gcloud was invoked with exactly these arguments
+func (f *FakeRunner) Called(args ...string) bool {
+	key := fakeKey(args)
+	for _, call := range f.Calls() {
+		if fakeKey(call) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// CallEnv returns the variables set for the last invocation with exactly
+// these arguments
+func (f *FakeRunner) CallEnv(args ...string) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := fakeKey(args)
+	for i := len(f.calls) - 1; i >= 0; i-- {
+		if fakeKey(f.calls[i]) == key {
+			return f.envs[i]
+		}
+	}
+	return nil
+}
+
+// Env returns the variables set for gcloud on top of the process environment
+func (f *FakeRunner) Env() map[string]string {
+	return f.env
+}
+
+// WithEnv returns a runner sharing the script that records env with its calls
+func (f *FakeRunner) WithEnv(env map[string]string) Runner {
+	return &FakeRunner{Missing: f.Missing, env: maps.Clone(env), fakeScript: f.fakeScript}
+}
+
+// Available reports whether the fake pretends gcloud is installed
+func (f *FakeRunner) Available() bool {
+	return !f.Missing
+}
+
+// Output returns the next scripted response for the arguments
+func (f *FakeRunner) Output(_ context.Context, args ...string) ([]byte, error) {
+	resp := f.next(args)
+	return []byte(resp.Output), resp.Err
+}
+
+// Interactive returns a command that replays the scripted errors of the
+// commands in turn, without a terminal, and reports the first one to fn
+func (f *FakeRunner) Interactive(fn tea.ExecCallback, commands ...[]string) tea.Cmd {
+	return func() tea.Msg {
+		for _, args := range commands {
+			if err := f.next(args).Err; err != nil {
+				return fn(stepFailed(args, err))
+			}
+		}
+		return fn(nil)
+	}
+}
+
+func (f *FakeRunner) next(args []string) FakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, append([]string(nil), args...))
+	f.envs = append(f.envs, f.env)
+
+	key := fakeKey(args)
+	if queue := f.responses[key]; len(queue) > 0 {
+		f.responses[key] = queue[1:]
+		f.last[key] = queue[0]
+	}
+	resp, ok := f.last[key]
+	if !ok {
+		return FakeResponse{Err: fmt.Errorf("unexpected gcloud call: gcloud %s", key)}
+	}
+	return resp
+}
+
+func fakeKey(args []string) string {
+	return strings.Join(args, " ")
+}
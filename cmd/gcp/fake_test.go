@@ -0,0 +1,59 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFakeRunnerQueues(t *testing.T) {
+	runner := NewFakeRunner().
+		Respond("first\n", "config", "get-value", "project").
+		Respond("second\n", "config", "get-value", "project")
+	ctx := context.Background()
+
+	// The last response repeats once the queue drains
+	for _, want := range []string{"first\n", "second\n", "second\n"} {
+		if output, err := runner.Output(ctx, "config", "get-value", "project"); err != nil || string(output) != want {
+			t.Errorf("Expected %q, got %q and %v", want, output, err)
+		}
+	}
+
+	if _, err := runner.Output(ctx, "config", "list"); err == nil || !strings.Contains(err.Error(), "unexpected gcloud call: gcloud config list") {
+		t.Errorf("Expected unscripted calls to fail, got %v", err)
+	}
+	if !runner.Called("config", "list") || len(runner.Calls()) != 4 {
+		t.Errorf("Expected every call to be recorded, got %q", runner.Calls())
+	}
+}
+
+func TestFakeRunnerWithEnv(t *testing.T) {
+	runner := NewFakeRunner()
+	derived := runner.WithEnv(map[string]string{"CLOUDSDK_ACTIVE_CONFIG_NAME": "client"})
+
+	// Responses scripted on the original are seen by derived runners
+	runner.Respond("", "config", "set", "project", "beta-456")
+	if _, err := derived.Output(context.Background(), "config", "set", "project", "beta-456"); err != nil {
+		t.Fatalf("Expected the shared script to answer, got %v", err)
+	}
+	if env := runner.CallEnv("config", "set", "project", "beta-456"); env["CLOUDSDK_ACTIVE_CONFIG_NAME"] != "client" {
+		t.Errorf("Expected the call to record its environment, got %v", env)
+	}
+}
+
+func TestFakeRunnerInteractive(t *testing.T) {
+	failure := errors.New("exit status 1")
+	runner := NewFakeRunner().
+		Respond("", "auth", "login").
+		Fail(failure, "", "auth", "application-default", "login")
+
+	var reported error
+	runner.Interactive(func(err error) tea.Msg { reported = err; return nil },
+		[]string{"auth", "login"}, []string{"auth", "application-default", "login"})()
+	if !errors.Is(reported, failure) || !strings.Contains(reported.Error(), "gcloud auth application-default login failed") {
+		t.Errorf("Expected the failing command to be reported, got %v", reported)
+	}
+}
@@ -0,0 +1,96 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// folderWorkers bounds how many folder listings run at once
+const folderWorkers = 8
+
+// GetHierarchy retrieves the organizations and every folder beneath them.
+// Folders are listed one level at a time since gcloud has no recursive
+// listing; the folders of a level are listed in parallel.
+func GetHierarchy(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		var organizations []types.Organization
+		err := listResources(ctx, r, &organizations, "organizations", "list", "--format=json")
+		cancel()
+		if err != nil {
+			return types.HierarchyMsg{Err: err}
+		}
+
+		var parents []string
+		for _, organization := range organizations {
+			parents = append(parents, "--organization="+strings.TrimPrefix(organization.Name, "organizations/"))
+		}
+		folders, err := listFolders(r, parents)
+		return types.HierarchyMsg{Organizations: organizations, Folders: folders, Err: err}
+	}
+}
+
+// listFolders lists every folder beneath the parents, level by level. Each
+// listing has its own timeout so that large trees are not cut short.
+func listFolders(r Runner, parents []string) ([]types.Folder, error) {
+	var all []types.Folder
+	for len(parents) > 0 {
+		levels := make([][]types.Folder, len(parents))
+		errs := make([]error, len(parents))
+		workers := make(chan struct{}, folderWorkers)
+		var wg sync.WaitGroup
+		for i, parent := range parents {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				workers <- struct{}{}
+				defer func() { <-workers }()
+
+				ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+				defer cancel()
+				errs[i] = listResources(ctx, r, &levels[i], "resource-manager", "folders", "list", parent, "--format=json")
+			}()
+		}
+		wg.Wait()
+
+		parents = nil
+		for _, folders := range levels {
+			for _, folder := range folders {
+				parents = append(parents, "--folder="+strings.TrimPrefix(folder.Name, "folders/"))
+			}
+			all = append(all, folders...)
+		}
+		if err := errors.Join(errs...); err != nil {
+			return all, err
+		}
+	}
+	return all, nil
+}
+
+// listResources runs a gcloud list command and decodes its JSON output
+func listResources(ctx context.Context, r Runner, v any, args ...string) error {
+	command := "gcloud " + strings.Join(args, " ")
+
+	output, err := r.Output(ctx, args...)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("command timed out: %s", command)
+		}
+		if errorOutput := strings.TrimSpace(string(output)); errorOutput != "" {
+			return fmt.Errorf("%s failed:\n%s", command, errorOutput)
+		}
+		return fmt.Errorf("%s failed: %w", command, err)
+	}
+
+	if err := json.Unmarshal(output, v); err != nil {
+		return fmt.Errorf("failed to parse %s output: %w", command, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package gcp
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// PropertyImpersonation is the service account gcloud impersonates
+const PropertyImpersonation = "auth/impersonate_service_account"
+
+// EnvImpersonation is the environment variable gcloud reads in place of
+// PropertyImpersonation
+const EnvImpersonation = "CLOUDSDK_AUTH_IMPERSONATE_SERVICE_ACCOUNT"
+
+// SetImpersonation makes gcloud act as a service account using the active
+// account's credentials. An empty service account stops impersonating.
+func SetImpersonation(r Runner, serviceAccount string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		args := []string{"config", "set", PropertyImpersonation, serviceAccount}
+		if serviceAccount == "" {
+			args = []string{"config", "unset", PropertyImpersonation}
+		}
+		if err := runSteps(ctx, r, args); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultImpersonationSet}
+	}
+}
+
+// ExportImpersonation returns the impersonated service account as an
+// environment export. An empty value overrides the configured one.
+func ExportImpersonation(serviceAccount string) tea.Cmd {
+	return func() tea.Msg {
+		return types.OperationResultMsg{
+			Success: true,
+			Kind:    types.ResultImpersonationSet,
+			Env:     map[string]string{EnvImpersonation: serviceAccount},
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// Compute properties holding the default region and zone
+const (
+	PropertyRegion = "compute/region"
+	PropertyZone   = "compute/zone"
+)
+
+// Environment variables gcloud reads in place of the compute properties
+const (
+	EnvRegion = "CLOUDSDK_COMPUTE_REGION"
+	EnvZone   = "CLOUDSDK_COMPUTE_ZONE"
+)
+
+// GetLocations retrieves the Compute Engine regions and zones available to
+// the active project
+func GetLocations(r Runner) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		var msg types.LocationListMsg
+		if err := listResources(ctx, r, &msg.Regions, "compute", "regions", "list", "--format=json"); err != nil {
+			return types.LocationListMsg{Err: err}
+		}
+		if err := listResources(ctx, r, &msg.Zones, "compute", "zones", "list", "--format=json"); err != nil {
+			return types.LocationListMsg{Err: err}
+		}
+		return msg
+	}
+}
+
+// SetLocation sets the default compute region and zone. An empty zone clears
+// the default zone.
+func SetLocation(r Runner, region, zone string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		steps := [][]string{{"config", "set", PropertyRegion, region}}
+		if zone != "" {
+			steps = append(steps, []string{"config", "set", PropertyZone, zone})
+		} else {
+			steps = append(steps, []string{"config", "unset", PropertyZone})
+		}
+
+		if err := runSteps(ctx, r, steps...); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+
+		return types.OperationResultMsg{Success: true, Kind: types.ResultLocationSet}
+	}
+}
+
+// SwitchProjectLocation switches to a project along with the region and zone
+// remembered for it, as one operation: if the location cannot be set, the
+// previous project is restored. An empty zone unsets it.
+func SwitchProjectLocation(r Runner, projectID, region, zone string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		_, err := applyChanges(ctx, r, []propertyChange{
+			{PropertyProject, projectID},
+			{PropertyRegion, region},
+			{PropertyZone, zone},
+		})
+		if err != nil {
+			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to project %s in %s: %w", projectID, region, err)}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultProjectSwitched}
+	}
+}
+
+// runSteps runs gcloud commands in order, stopping at the first failure
+func runSteps(ctx context.Context, r Runner, steps ...[]string) error {
+	for _, args := range steps {
+		output, err := r.Output(ctx, args...)
+		if err != nil {
+			command := "gcloud " + strings.Join(args, " ")
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("command timed out: %s", command)
+			}
+			if errorOutput := strings.TrimSpace(string(output)); errorOutput != "" {
+				return fmt.Errorf("%s failed:\n%s", command, errorOutput)
+			}
+			return fmt.Errorf("%s failed: %v", command, err)
+		}
+	}
+	return nil
+}
+
+// ExportLocation returns a region and zone as environment exports. An empty
+// zone is exported as an empty value, overriding the configured default zone.
+func ExportLocation(region, zone string) tea.Cmd {
+	return func() tea.Msg {
+		return types.OperationResultMsg{
+			Success: true,
+			Kind:    types.ResultLocationSet,
+			Env:     map[string]string{EnvRegion: region, EnvZone: zone},
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// Core properties holding the active account and project
+const (
+	PropertyAccount = "account"
+	PropertyProject = "project"
+)
+
+// EnvQuotaProject is the environment variable client libraries read in
+// place of the quota project of the Application Default Credentials
+const EnvQuotaProject = "GOOGLE_CLOUD_QUOTA_PROJECT"
+
+// Context is everything a profile switches to. Empty region, zone and
+// impersonation are unset so that nothing lingers from the previous context;
+// an empty quota project leaves the Application Default Credentials alone.
+type Context struct {
+	Account      string
+	Project      string
+	Region       string
+	Zone         string
+	Impersonate  string
+	QuotaProject string
+}
+
+// propertyChange sets a gcloud property; an empty value unsets it
+type propertyChange struct {
+	property string
+	value    string
+}
+
+// section returns the configuration file section and key of the property
+func (c propertyChange) section() (string, string) {
+	if section, key, ok := strings.Cut(c.property, "/"); ok {
+		return section, key
+	}
+	return "core", c.property
+}
+
+// args returns the gcloud command making the change
+func (c propertyChange) args() []string {
+	if c.value == "" {
+		return []string{"config", "unset", c.property}
+	}
+	return []string{"config", "set", c.property, c.value}
+}
+
+// changes lists the properties set by the context, in the order they are applied
+func (c Context) changes() []propertyChange {
+	return []propertyChange{
+		{PropertyAccount, c.Account},
+		{PropertyProject, c.Project},
+		{PropertyRegion, c.Region},
+		{PropertyZone, c.Zone},
+		{PropertyImpersonation, c.Impersonate},
+	}
+}
+
+// ApplyContext switches gcloud to a context as one operation. The previous
+// values are read first, and if any step fails the properties already
+// changed are restored, so gcloud is never left half switched.
+func ApplyContext(r Runner, c Context) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		if err := checkAuthenticated(ctx, r, c.Account); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+
+		applied, err := applyChanges(ctx, r, c.changes())
+		if err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+
+		// The quota project goes last since it cannot be rolled back
+		if c.QuotaProject != "" {
+			if err := runSteps(ctx, r, []string{"auth", "application-default", "set-quota-project", c.QuotaProject}); err != nil {
+				return types.OperationResultMsg{Success: false, Err: rollback(r, applied, err)}
+			}
+		}
+
+		return types.OperationResultMsg{Success: true, Kind: types.ResultProfileApplied}
+	}
+}
+
+// ExportContext validates the account of a context and returns the context
+// as environment exports
+func ExportContext(r Runner, c Context) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		if err := checkAuthenticated(ctx, r, c.Account); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+
+		env := map[string]string{
+			EnvAccount:       c.Account,
+			EnvProject:       c.Project,
+			EnvRegion:        c.Region,
+			EnvZone:          c.Zone,
+			EnvImpersonation: c.Impersonate,
+		}
+		if c.QuotaProject != "" {
+			env[EnvQuotaProject] = c.QuotaProject
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultProfileApplied, Env: env}
+	}
+}
+
+// applyChanges sets gcloud properties as one operation. The previous values
+// are read from the active configuration file and restored if any step fails.
+// Environment overrides are left out on purpose: restoring them would write
+// them into the file. The previous values of the properties that were
+// changed are returned so that a later failure can restore them too.
+func applyChanges(ctx context.Context, r Runner, changes []propertyChange) ([]propertyChange, error) {
+	config, err := gcloudconfig.LoadActiveWith(r.Env())
+	if err != nil && !errors.Is(err, gcloudconfig.ErrNotFound) {
+		// A configuration gcloud has not written yet has nothing to restore
+		return nil, err
+	}
+	previous := make([]propertyChange, len(changes))
+	for i, change := range changes {
+		previous[i] = propertyChange{change.property, config.Get(change.section())}
+	}
+
+	var applied []propertyChange
+	for i, change := range changes {
+		if change.value == previous[i].value {
+			continue
+		}
+		if err := runSteps(ctx, r, change.args()); err != nil {
+			return nil, rollback(r, applied, err)
+		}
+		applied = append(applied, previous[i])
+	}
+	return applied, nil
+}
+
+// rollback restores the previous values of changed properties, newest first,
+// and explains the failure that caused it
+func rollback(r Runner, previous []propertyChange, cause error) error {
+	if len(previous) == 0 {
+		return cause
+	}
+
+	// The operation may have failed by running out of time, so restoring
+	// gets a deadline of its own
+	ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+	defer cancel()
+
+	var errs []error
+	for i := len(previous) - 1; i >= 0; i-- {
+		if err := runSteps(ctx, r, previous[i].args()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%w\n\nRestoring the previous settings also failed:\n%v", cause, err)
+	}
+	return fmt.Errorf("%w\n\nThe previous settings were restored.", cause)
+}
+
+// propertyValue reads a gcloud property; unset properties are empty
+func propertyValue(ctx context.Context, r Runner, property string) (string, error) {
+	output, err := r.Output(ctx, "config", "get-value", property)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("command timed out: gcloud config get-value %s", property)
+		}
+		return "", fmt.Errorf("failed to read %s: %w", property, err)
+	}
+	value := strings.TrimSpace(string(output))
+	if value == "(unset)" {
+		return "", nil
+	}
+	return value, nil
+}
@@ -0,0 +1,120 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfig points gcloud at a directory whose default configuration
+// holds contents
+func writeConfig(t *testing.T, contents string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CLOUDSDK_CONFIG", dir)
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "")
+	if err := os.MkdirAll(filepath.Join(dir, "configurations"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "configurations", "config_default"), []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyChangesRollsBackNewestFirst(t *testing.T) {
+	writeConfig(t, "[core]\naccount = alice@example.com\nproject = alpha-123\n\n[compute]\nregion = us-east1\n")
+	runner := NewFakeRunner().
+		Respond("", "config", "set", "account", "bob@example.com").
+		Respond("", "config", "set", "project", "beta-456").
+		Fail(errors.New("exit status 1"), "ERROR: Invalid zone", "config", "set", "compute/zone", "europe-west9-z").
+		Respond("", "config", "set", "project", "alpha-123").
+		Respond("", "config", "set", "account", "alice@example.com")
+
+	_, err := applyChanges(context.Background(), runner, []propertyChange{
+		{PropertyAccount, "bob@example.com"},
+		{PropertyProject, "beta-456"},
+		{PropertyRegion, "us-east1"}, // Already set, so left alone
+		{PropertyZone, "europe-west9-z"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "Invalid zone") || !strings.Contains(err.Error(), "The previous settings were restored.") {
+		t.Fatalf("Expected the failure and the restore to be reported, got %v", err)
+	}
+
+	want := [][]string{
+		{"config", "set", "account", "bob@example.com"},
+		{"config", "set", "project", "beta-456"},
+		{"config", "set", "compute/zone", "europe-west9-z"},
+		{"config", "set", "project", "alpha-123"},
+		{"config", "set", "account", "alice@example.com"},
+	}
+	if calls := runner.Calls(); !slices.EqualFunc(calls, want, slices.Equal) {
+		t.Errorf("Expected the changes undone newest first, got %q", calls)
+	}
+}
+
+func TestApplyChangesIgnoresEnvironmentOverrides(t *testing.T) {
+	writeConfig(t, "[core]\naccount = alice@example.com\n")
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "env-only")
+	runner := NewFakeRunner().
+		Respond("", "config", "set", "project", "beta-456").
+		Fail(errors.New("exit status 1"), "", "config", "set", "compute/region", "europe-west9").
+		Respond("", "config", "unset", "project")
+
+	_, err := applyChanges(context.Background(), runner, []propertyChange{
+		{PropertyProject, "beta-456"},
+		{PropertyRegion, "europe-west9"},
+	})
+	if err == nil {
+		t.Fatal("Expected the region to fail")
+	}
+	if !runner.Called("config", "unset", "project") || runner.Called("config", "set", "project", "env-only") {
+		t.Errorf("Expected the project unset as in the file rather than set to the environment value, got %q", runner.Calls())
+	}
+}
+
+func TestApplyChangesWithoutConfiguration(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+	runner := NewFakeRunner().
+		Respond("", "config", "set", "project", "beta-456")
+
+	previous, err := applyChanges(context.Background(), runner, []propertyChange{{PropertyProject, "beta-456"}})
+	if err != nil {
+		t.Fatalf("applyChanges failed: %v", err)
+	}
+	if len(previous) != 1 || previous[0] != (propertyChange{PropertyProject, ""}) {
+		t.Errorf("Expected the project to be restored by unsetting it, got %+v", previous)
+	}
+}
+
+func TestRollbackFailure(t *testing.T) {
+	runner := NewFakeRunner().
+		Fail(errors.New("exit status 1"), "ERROR: offline", "config", "set", "account", "alice@example.com")
+
+	err := rollback(runner, []propertyChange{{PropertyAccount, "alice@example.com"}}, errors.New("project failed"))
+	if err == nil || !strings.HasPrefix(err.Error(), "project failed") || !strings.Contains(err.Error(), "Restoring the previous settings also failed:") {
+		t.Errorf("Expected both failures to be reported, got %v", err)
+	}
+
+	cause := errors.New("nothing changed")
+	if err := rollback(runner, nil, cause); err != cause {
+		t.Errorf("Expected the cause alone when nothing was changed, got %v", err)
+	}
+}
+
+func TestPropertyChangeSection(t *testing.T) {
+	for _, tc := range []struct{ property, section, key string }{
+		{PropertyAccount, "core", "account"},
+		{PropertyZone, "compute", "zone"},
+		{PropertyImpersonation, "auth", "impersonate_service_account"},
+	} {
+		if section, key := (propertyChange{property: tc.property}).section(); section != tc.section || key != tc.key {
+			t.Errorf("Expected %s to be %s/%s, got %s/%s", tc.property, tc.section, tc.key, section, key)
+		}
+	}
+}
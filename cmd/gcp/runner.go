@@ -0,0 +1,128 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Runner executes gcloud invocations on behalf of the command functions.
+// Swapping it out lets the rest of the application run without a real SDK.
+type Runner interface {
+	// Available reports whether gcloud can be executed
+	Available() bool
+	// Output runs gcloud with the given arguments and returns its combined output
+	Output(ctx context.Context, args ...string) ([]byte, error)
+	// Interactive runs gcloud commands one after another attached to the
+	// user's terminal while the interface is suspended, stopping at the
+	// first failure, and reports the outcome to fn
+	Interactive(fn tea.ExecCallback, commands ...[]string) tea.Cmd
+	// Env returns the variables set for gcloud on top of the process environment
+	Env() map[string]string
+	// WithEnv returns a Runner that sets exactly these variables for gcloud
+	// on top of the process environment, such as those exported in export mode
+	WithEnv(env map[string]string) Runner
+}
+
+// ExecRunner runs the gcloud binary found in PATH
+type ExecRunner struct {
+	env map[string]string
+}
+
+// NewExecRunner returns a Runner backed by the real gcloud CLI
+func NewExecRunner() ExecRunner {
+	return ExecRunner{}
+}
+
+// Available checks if gcloud CLI is installed
+func (ExecRunner) Available() bool {
+	_, err := exec.LookPath("gcloud")
+	return err == nil
+}
+
+// Output runs gcloud and captures stdout and stderr
+func (r ExecRunner) Output(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "gcloud", args...)
+	cmd.Env = r.environ()
+	return cmd.CombinedOutput()
+}
+
+// Interactive runs gcloud on the terminal handed over by Bubble Tea
+func (r ExecRunner) Interactive(fn tea.ExecCallback, commands ...[]string) tea.Cmd {
+	steps := &terminalSteps{args: commands}
+	for _, args := range commands {
+		cmd := exec.Command("gcloud", args...)
+		cmd.Env = r.environ()
+		steps.commands = append(steps.commands, cmd)
+	}
+	return tea.Exec(steps, fn)
+}
+
+// Env returns the variables set for gcloud on top of the process environment
+func (r ExecRunner) Env() map[string]string {
+	return r.env
+}
+
+// WithEnv returns a copy of the runner that sets env for gcloud
+func (ExecRunner) WithEnv(env map[string]string) Runner {
+	return ExecRunner{env: maps.Clone(env)}
+}
+
+// environ returns the environment gcloud runs with; nil inherits the
+// process environment unchanged
+func (r ExecRunner) environ() []string {
+	if len(r.env) == 0 {
+		return nil
+	}
+	env := os.Environ()
+	for name, value := range r.env {
+		// exec keeps the last value of a duplicated variable
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// terminalSteps is a tea.ExecCommand running gcloud commands one after
+// another, stopping at the first failure
+type terminalSteps struct {
+	args     [][]string
+	commands []*exec.Cmd
+}
+
+func (s *terminalSteps) Run() error {
+	for i, command := range s.commands {
+		if err := command.Run(); err != nil {
+			return stepFailed(s.args[i], err)
+		}
+	}
+	return nil
+}
+
+func (s *terminalSteps) SetStdin(r io.Reader) {
+	for _, command := range s.commands {
+		command.Stdin = r
+	}
+}
+
+func (s *terminalSteps) SetStdout(w io.Writer) {
+	for _, command := range s.commands {
+		command.Stdout = w
+	}
+}
+
+func (s *terminalSteps) SetStderr(w io.Writer) {
+	for _, command := range s.commands {
+		command.Stderr = w
+	}
+}
+
+// stepFailed explains which of several interactive commands failed
+func stepFailed(args []string, err error) error {
+	return fmt.Errorf("gcloud %s failed: %w", strings.Join(args, " "), err)
+}
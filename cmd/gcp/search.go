@@ -0,0 +1,58 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// SearchProjects lists the projects visible to each account in parallel.
+// Every call passes --account, so the active account is left alone.
+func SearchProjects(r Runner, accounts []string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		results := make([]types.AccountProjects, len(accounts))
+		var wg sync.WaitGroup
+		for i, account := range accounts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				results[i].Account = account
+				results[i].Err = listResources(ctx, r, &results[i].Projects, "projects", "list", "--format=json", "--account="+account)
+			}()
+		}
+		wg.Wait()
+		return types.ProjectSearchMsg{Results: results}
+	}
+}
+
+// SwitchAccountProject switches to an account and one of its projects, and to
+// the region and zone of c when it has one. Like ApplyContext, the previous
+// values are read first and restored if any step fails, so gcloud is never
+// left on the new account with the old project.
+func SwitchAccountProject(r Runner, c Context) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), longTimeout)
+		defer cancel()
+
+		if err := checkAuthenticated(ctx, r, c.Account); err != nil {
+			return types.OperationResultMsg{Success: false, Err: err}
+		}
+		changes := []propertyChange{
+			{PropertyAccount, c.Account},
+			{PropertyProject, c.Project},
+		}
+		if c.Region != "" {
+			changes = append(changes, propertyChange{PropertyRegion, c.Region}, propertyChange{PropertyZone, c.Zone})
+		}
+		if _, err := applyChanges(ctx, r, changes); err != nil {
+			return types.OperationResultMsg{Success: false, Err: fmt.Errorf("failed to switch to %s on %s: %w", c.Project, c.Account, err)}
+		}
+		return types.OperationResultMsg{Success: true, Kind: types.ResultProjectSwitched}
+	}
+}
@@ -0,0 +1,122 @@
+package gcp
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// EnvCloudProject is the project client libraries and tools built on them,
+// such as Terraform, use in place of the gcloud project
+const EnvCloudProject = "GOOGLE_CLOUD_PROJECT"
+
+// VerifySwitch reads back the effective account and project after a switch
+// and reports the sources that win over what was switched to. Values left
+// empty in want are compared with the active configuration file instead.
+func VerifySwitch(r Runner, want Context) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+		defer cancel()
+
+		effective, err := effectiveContext(ctx, r)
+		if err != nil {
+			return types.VerificationMsg{Err: err}
+		}
+		want = configured(r, want)
+		drifts := drift(want, effective, r.Env())
+		if credentials, ok := credentialsDrift(cmp.Or(want.Account, effective.Account), r.Env()); ok {
+			drifts = append(drifts, credentials)
+		}
+		return types.VerificationMsg{Drift: drifts}
+	}
+}
+
+// effectiveContext returns the account and project gcloud actually uses,
+// environment overrides included
+func effectiveContext(ctx context.Context, r Runner) (Context, error) {
+	if props, err := Resolve(r); err == nil {
+		return Context{Account: props.Account, Project: props.Project}, nil
+	}
+
+	account, err := propertyValue(ctx, r, PropertyAccount)
+	if err != nil {
+		return Context{}, err
+	}
+	project, err := propertyValue(ctx, r, PropertyProject)
+	if err != nil {
+		return Context{}, err
+	}
+	return Context{Account: account, Project: project}, nil
+}
+
+// configured fills in the account and project that were not switched with
+// the values written to the active configuration file
+func configured(r Runner, want Context) Context {
+	if config, err := gcloudconfig.LoadActiveWith(r.Env()); err == nil {
+		want.Account = cmp.Or(want.Account, config.Get("core", PropertyAccount))
+		want.Project = cmp.Or(want.Project, config.Get("core", PropertyProject))
+	}
+	return want
+}
+
+// drift explains every source that wins over the wanted account and project.
+// Variables are looked up in env before the process environment.
+func drift(want, effective Context, env gcloudconfig.Env) []types.Drift {
+	var drifts []types.Drift
+	for _, property := range []struct{ name, variable, want, effective string }{
+		{PropertyAccount, EnvAccount, want.Account, effective.Account},
+		{PropertyProject, EnvProject, want.Project, effective.Project},
+	} {
+		if property.want == "" || property.effective == property.want {
+			continue
+		}
+		value := env.Getenv(property.variable)
+		if value == "" {
+			// Neither the file nor the environment explain it, e.g. a gcloud wrapper
+			drifts = append(drifts, types.Drift{
+				Message: fmt.Sprintf("gcloud reports %s %q instead of %s", property.name, property.effective, property.want),
+			})
+			continue
+		}
+		drifts = append(drifts, types.Drift{
+			Variable: property.variable,
+			Message:  fmt.Sprintf("%s is set and wins over gcloud's configuration: gcloud uses %s %s, not %s", property.variable, property.name, value, property.want),
+		})
+	}
+
+	if project := env.Getenv(EnvCloudProject); project != "" && effective.Project != "" && project != effective.Project {
+		drifts = append(drifts, types.Drift{
+			Variable: EnvCloudProject,
+			Message:  fmt.Sprintf("%s is set and wins over the gcloud project for client libraries and Terraform: they use %s, not %s", EnvCloudProject, project, effective.Project),
+		})
+	}
+	return drifts
+}
+
+// credentialsDrift reports GOOGLE_APPLICATION_CREDENTIALS when the
+// credentials it points to act as another identity than the account. The
+// identity is read from the file, as on the ADC screen; credentials that do
+// not record it are not reported.
+func credentialsDrift(account string, env gcloudconfig.Env) (types.Drift, bool) {
+	if account == "" || env.Getenv(EnvCredentials) == "" {
+		return types.Drift{}, false
+	}
+	adc, err := ReadADC(env)
+	if err != nil {
+		return types.Drift{
+			Variable: EnvCredentials,
+			Message:  fmt.Sprintf("%s is set but cannot be read: %v", EnvCredentials, err),
+		}, true
+	}
+	if adc.Account == "" || adc.Account == account {
+		return types.Drift{}, false
+	}
+	return types.Drift{
+		Variable: EnvCredentials,
+		Message:  fmt.Sprintf("%s is set and wins over the gcloud login: client libraries authenticate as %s, not %s", EnvCredentials, adc.Account, account),
+	}, true
+}
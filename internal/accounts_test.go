@@ -0,0 +1,279 @@
+package internal
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/history"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestUpdateSwitchAccount(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)").
+		Respond("Updated property [core/account].", "config", "set", "account", "bob@example.com")
+
+	m = pressKey(m, "a")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming {
+		t.Fatalf("Expected StateConfirming, got %v", m.StateMachine.GetState())
+	}
+
+	runner.Respond("bob@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)")
+	m = pressKey(m, "enter")
+
+	if m.Data.ActiveAccount != "bob@example.com" {
+		t.Errorf("Expected active account bob@example.com, got %q", m.Data.ActiveAccount)
+	}
+	if m.Data.ActiveProject != "" {
+		t.Errorf("Expected active project to be cleared, got %q", m.Data.ActiveProject)
+	}
+	// Switching accounts forces project selection
+	if m.StateMachine.GetState() != StateProjects {
+		t.Errorf("Expected StateProjects after account switch, got %v", m.StateMachine.GetState())
+	}
+}
+
+func TestUpdateSwitchAccountNotAuthenticated(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)")
+
+	m = pressKey(m, "a")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+
+	if m.StateMachine.GetState() != StateError {
+		t.Fatalf("Expected StateError, got %v", m.StateMachine.GetState())
+	}
+	if runner.Called("config", "set", "account", "bob@example.com") {
+		t.Error("Expected the switch to be refused before calling gcloud config set")
+	}
+	if !strings.Contains(m.View(), "is not authenticated") {
+		t.Error("Expected error view to explain the account is not authenticated")
+	}
+}
+
+func TestUpdateRestoresProjectOnAccountSwitch(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)").
+		Respond("Updated property [core/account].", "config", "set", "account", "bob@example.com").
+		Respond("Updated property [core/project].", "config", "set", "project", "beta-456")
+	m.Data.History.Add(history.Entry{Time: time.Now(), Account: "bob@example.com", Project: "beta-456"})
+
+	m = pressKey(m, "a")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "back to project beta-456") {
+		t.Error("Expected the confirmation to mention the project being restored")
+	}
+
+	runner.Respond("bob@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)")
+	runner.Respond("beta-456\n", "config", "get-value", "project")
+	m = pressKey(m, "enter")
+
+	if m.StateMachine.GetState() != StateMain {
+		t.Fatalf("Expected to land on the main screen, got %v", m.StateMachine.GetState())
+	}
+	if m.Data.ActiveAccount != "bob@example.com" || m.Data.ActiveProject != "beta-456" {
+		t.Errorf("Expected bob@example.com on beta-456, got %q on %q", m.Data.ActiveAccount, m.Data.ActiveProject)
+	}
+
+	// Protected projects still need their ID typed
+	m.Settings.Protected = []userconfig.ProtectionRule{{Project: "alpha-*"}}
+	m.Data.History.Add(history.Entry{Time: time.Now(), Account: "alice@example.com", Project: "alpha-123"})
+	runner.Respond("alice@example.com\n", "auth", "list", "--filter=account:alice@example.com", "--format=value(account)")
+	runner.Respond("Updated property [core/account].", "config", "set", "account", "alice@example.com")
+	m = pressKey(m, "a")
+	m.selectAccount("alice@example.com")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming || m.StateMachine.GetContext().Pending.Confirm != ConfirmTyped {
+		t.Fatalf("Expected typed confirmation of the protected project, got %v", m.StateMachine.GetState())
+	}
+	if runner.Called("config", "set", "project", "alpha-123") {
+		t.Error("Expected the protected project not to be restored before confirming")
+	}
+
+	// With pick_project the picker opens instead
+	m = pressKey(m, "esc")
+	m.Settings.PickProject = true
+	m = pressKey(m, "a")
+	m.selectAccount("bob@example.com")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateProjects {
+		t.Errorf("Expected the project picker with pick_project set, got %v", m.StateMachine.GetState())
+	}
+}
+
+func TestUpdateRestoredProjectProtection(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)").
+		Respond("Updated property [core/account].", "config", "set", "account", "bob@example.com")
+	m.Settings.Protected = []userconfig.ProtectionRule{{Label: "env=prod"}}
+	m.Data.History.Add(history.Entry{Time: time.Now(), Account: "bob@example.com", Project: "ledger-prod"})
+
+	// Only bob sees the project, so its labels come from bob's project list
+	runner.Respond(`[{"projectId":"ledger-prod","name":"Ledger","labels":{"env":"prod"}}]`, "projects", "list", "--format=json")
+	m = pressKey(m, "a")
+	m.selectAccount("bob@example.com")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming || m.StateMachine.GetContext().Pending.Confirm != ConfirmTyped {
+		t.Fatalf("Expected typed confirmation of the project labeled for bob, got %v", m.StateMachine.GetState())
+	}
+	if !strings.Contains(m.View(), "PROTECTED PROJECT (label env=prod)") {
+		t.Errorf("Expected the label rule in the confirmation:\n%s", m.View())
+	}
+	if runner.Called("config", "set", "project", "ledger-prod") {
+		t.Error("Expected the protected project not to be restored before confirming")
+	}
+
+	// Without the project list, the labels are unknown and the ID is still typed
+	m = pressKey(m, "esc")
+	runner.Respond("alice@example.com\n", "auth", "list", "--filter=account:alice@example.com", "--format=value(account)").
+		Respond("Updated property [core/account].", "config", "set", "account", "alice@example.com").
+		Fail(errors.New("exit status 1"), "ERROR: permission denied", "projects", "list", "--format=json")
+	m.Data.History.Add(history.Entry{Time: time.Now(), Account: "alice@example.com", Project: "alpha-123"})
+	m = pressKey(m, "a")
+	m.selectAccount("alice@example.com")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming || !strings.Contains(m.View(), "PROTECTED PROJECT (labels and folder unknown)") {
+		t.Errorf("Expected typed confirmation of a project with unknown labels, got %v:\n%s", m.StateMachine.GetState(), m.View())
+	}
+}
+
+func TestUpdateImpersonation(t *testing.T) {
+	const deployer = "deployer@alpha-123.iam.gserviceaccount.com"
+	m, runner := newTestModel(t)
+	runner.
+		Respond("", "config", "set", "auth/impersonate_service_account", deployer).
+		Respond("", "config", "unset", "auth/impersonate_service_account")
+	m.Settings.Impersonation = map[string][]string{"alpha-123": {deployer}, "beta-456": {"other@beta-456.iam.gserviceaccount.com"}}
+	m.updateAccountList()
+
+	m = pressKey(m, "a")
+	items := m.Components.AccountList.Items()
+	if len(items) != 3 || items[2].(types.Item).ID() != deployer {
+		t.Fatalf("Expected the accounts followed by the target of alpha-123, got %v", items)
+	}
+
+	m.Components.AccountList.Select(2)
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Act as "+deployer+" via alice@example.com?") {
+		t.Fatalf("Expected the impersonation confirmation:\n%s", m.View())
+	}
+	runner.Respond(deployer+"\n", "config", "get-value", "auth/impersonate_service_account")
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "set", "auth/impersonate_service_account", deployer) {
+		t.Fatal("Expected the service account to be impersonated")
+	}
+	if !strings.Contains(m.View(), "Acting As: "+deployer+" via alice@example.com") {
+		t.Errorf("Expected the main screen to show the impersonation:\n%s", m.View())
+	}
+
+	// i in the account list stops impersonating
+	m = pressKey(m, "a")
+	m = pressKey(m, "i")
+	if !strings.Contains(m.View(), "Stop acting as "+deployer) {
+		t.Fatalf("Expected the confirmation to stop impersonating:\n%s", m.View())
+	}
+	runner.Respond("\n", "config", "get-value", "auth/impersonate_service_account")
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "unset", "auth/impersonate_service_account") || m.Data.Impersonating != "" {
+		t.Errorf("Expected impersonation to be cleared, still acting as %q", m.Data.Impersonating)
+	}
+}
+
+func TestUpdateAccountCleanup(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("ya29.token\n", "auth", "print-access-token", "alice@example.com").
+		Fail(errors.New("exit status 1"), "Reauthentication required.", "auth", "print-access-token", "bob@example.com").
+		Respond("", "auth", "revoke", "bob@example.com")
+
+	m = pressKey(m, "a")
+	m = pressKey(m, "c")
+	if m.StateMachine.GetState() != StateCleanup || m.UI.CheckingAccounts {
+		t.Fatalf("Expected the checked accounts in StateCleanup, got %v", m.StateMachine.GetState())
+	}
+	if view := m.View(); !strings.Contains(view, "✗ bob@example.com") || strings.Contains(view, "✗ alice@example.com") {
+		t.Fatalf("Expected only bob@example.com to be listed:\n%s", view)
+	}
+
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Revoke bob@example.com, whose credentials no longer work?") {
+		t.Fatalf("Expected the bulk confirmation:\n%s", m.View())
+	}
+	m = pressKey(m, "enter")
+	if !runner.Called("auth", "revoke", "bob@example.com") {
+		t.Error("Expected bob@example.com to be revoked")
+	}
+
+	// A single account is revoked from the account list
+	m = pressKey(m, "a")
+	m = pressKey(m, "x")
+	if m.StateMachine.GetState() != StateConfirming || m.StateMachine.GetContext().Pending.Kind != ActionRevokeCredential {
+		t.Errorf("Expected a revoke confirmation, got %v", m.StateMachine.GetState())
+	}
+}
+
+func TestUpdateLogin(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("", "auth", "login", "--no-launch-browser").
+		Respond("", "auth", "application-default", "login", "--no-launch-browser")
+	m.Settings.Login = userconfig.Login{Browser: userconfig.BrowserManual}
+
+	m = pressKey(m, "l")
+	if m.StateMachine.GetState() != StateConfirming {
+		t.Fatalf("Expected StateConfirming, got %v", m.StateMachine.GetState())
+	}
+
+	runner.Respond(`[{"account":"alice@example.com","status":""},{"account":"bob@example.com","status":""},{"account":"carol@example.com","status":"ACTIVE"}]`,
+		"auth", "list", "--format=json")
+	runner.Respond("carol@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)")
+	m = pressKey(m, "enter")
+
+	calls := runner.Calls()
+	login := slices.IndexFunc(calls, func(call []string) bool { return slices.Equal(call, []string{"auth", "login", "--no-launch-browser"}) })
+	adc := slices.IndexFunc(calls, func(call []string) bool {
+		return slices.Equal(call, []string{"auth", "application-default", "login", "--no-launch-browser"})
+	})
+	if login < 0 || adc < login {
+		t.Errorf("Expected the Application Default Credentials login to follow, got calls %v", calls)
+	}
+	if msg, ok := gcp.LoginNewAccount(runner, gcp.LoginOptions{Flags: []string{"--no-launch-browser"}, SkipADC: true})().(types.OperationResultMsg); !ok || !msg.Success || msg.Kind != types.ResultLoggedIn {
+		t.Errorf("Expected a successful login result, got %+v", msg)
+	}
+	if m.StateMachine.GetState() != StateAccounts {
+		t.Fatalf("Expected the account list after logging in, got %v", m.StateMachine.GetState())
+	}
+	if selected := m.Components.AccountList.SelectedItem().(types.Item).ID(); selected != "carol@example.com" {
+		t.Errorf("Expected the new account to be selected, got %q", selected)
+	}
+
+	// A failed login reports the command and leaves ADC alone
+	m, runner = newTestModel(t)
+	runner.Fail(errors.New("exit status 1"), "", "auth", "login")
+	m.Settings.Login = userconfig.Login{SkipADC: true}
+	m = pressKey(m, "l")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateError || !strings.Contains(m.UI.Err.Error(), "gcloud auth login failed") {
+		t.Errorf("Expected the failed login to be reported, got %v: %v", m.StateMachine.GetState(), m.UI.Err)
+	}
+	if runner.Called("auth", "application-default", "login") {
+		t.Error("Expected no Application Default Credentials login when it is skipped")
+	}
+}
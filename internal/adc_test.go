@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+)
+
+func TestUpdateADC(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("", "auth", "application-default", "set-quota-project", "beta-456")
+	adcFile := filepath.Join(os.Getenv("CLOUDSDK_CONFIG"), "application_default_credentials.json")
+	if err := os.WriteFile(adcFile, []byte(`{"type":"authorized_user","account":"bob@example.com","quota_project_id":"alpha-123"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m = send(m, gcp.GetADC(runner)())
+
+	if !strings.Contains(m.View(), "Application Default Credentials use bob@example.com, gcloud uses alice@example.com") {
+		t.Errorf("Expected the ADC mismatch on the main screen:\n%s", m.View())
+	}
+
+	m = pressKey(m, "d")
+	if m.StateMachine.GetState() != StateADC {
+		t.Fatalf("Expected StateADC, got %v", m.StateMachine.GetState())
+	}
+	if view := m.View(); !strings.Contains(view, "Identity: bob@example.com") || !strings.Contains(view, "Quota project: alpha-123") {
+		t.Errorf("Expected the ADC identity and quota project:\n%s", view)
+	}
+
+	m = pressKey(m, "p")
+	if m.StateMachine.GetState() != StateQuotaProject || m.Components.QuotaInput.Value() != "alpha-123" {
+		t.Fatalf("Expected the quota project input prefilled, got %v with %q", m.StateMachine.GetState(), m.Components.QuotaInput.Value())
+	}
+	m.Components.QuotaInput.SetValue("beta-456")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if !runner.Called("auth", "application-default", "set-quota-project", "beta-456") {
+		t.Error("Expected the quota project to be set")
+	}
+
+	// Credentials from the environment cannot be revoked by gcloud
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(keyFile, []byte(`{"type":"service_account","client_email":"ci@alpha-123.iam.gserviceaccount.com"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", keyFile)
+	m = pressKey(m, "d")
+	m = pressKey(m, "x")
+	if m.StateMachine.GetState() != StateADC {
+		t.Errorf("Expected revoking credentials from the environment to be refused, got %v", m.StateMachine.GetState())
+	}
+	if view := m.View(); !strings.Contains(view, "ci@alpha-123.iam.gserviceaccount.com") || !strings.Contains(view, "GOOGLE_APPLICATION_CREDENTIALS takes precedence") {
+		t.Errorf("Expected the service account from the environment:\n%s", view)
+	}
+}
+
+func TestUpdateADCIdentityLookup(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("WARNING: quota project not set\nya29.token\n", "auth", "application-default", "print-access-token")
+	adcFile := filepath.Join(os.Getenv("CLOUDSDK_CONFIG"), "application_default_credentials.json")
+	if err := os.WriteFile(adcFile, []byte(`{"type":"authorized_user","client_id":"123"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var requests []string
+	m.HTTP = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		requests = append(requests, req.Method+" "+req.URL.String()+" "+string(body))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"email":"bob@example.com"}`)),
+		}, nil
+	})}
+
+	// Startup looks the identity up once, so the main screen can compare it
+	m = send(m, gcp.GetADC(runner)())
+	want := "POST https://oauth2.googleapis.com/tokeninfo access_token=ya29.token"
+	if len(requests) != 1 || requests[0] != want {
+		t.Fatalf("Expected the token in the body of one token info request, got %q", requests)
+	}
+	if !strings.Contains(m.View(), "Application Default Credentials use bob@example.com, gcloud uses alice@example.com") {
+		t.Errorf("Expected the ADC mismatch on the main screen:\n%s", m.View())
+	}
+
+	// Rereading the same file keeps the identity without another lookup
+	m = send(m, gcp.GetADC(runner)())
+	m = pressKey(m, "d")
+	if len(requests) != 1 {
+		t.Errorf("Expected no further token info request, got %q", requests)
+	}
+	if view := m.View(); !strings.Contains(view, "Identity: bob@example.com") {
+		t.Errorf("Expected the looked up identity:\n%s", view)
+	}
+}
@@ -0,0 +1,71 @@
+// Package atomicfile reads and rewrites the small files gcp-switcher keeps
+// its settings and state in, so that no reader ever sees a partial file.
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// mu serializes read-modify-write cycles within the process
+var mu sync.Mutex
+
+// Read returns the content of a file, or nil when it does not exist
+func Read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Update passes the content of a file, nil when it does not exist, to change
+// and writes the result back. Updates made by this process never overwrite
+// each other.
+func Update(path string, change func(data []byte) ([]byte, error)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	data, err := Read(path)
+	if err != nil {
+		return err
+	}
+	data, err = change(data)
+	if err != nil {
+		return err
+	}
+	return Write(path, data)
+}
+
+// Write replaces a file, creating its directory if needed. The data is
+// written to a uniquely named file next to it that is then renamed over it,
+// so readers see either the old or the new content, and writers in other
+// processes never share a temporary file.
+func Write(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	// Removing fails harmlessly once the file has been renamed
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
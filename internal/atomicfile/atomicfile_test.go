@@ -0,0 +1,83 @@
+package atomicfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestReadMissingFile(t *testing.T) {
+	data, err := Read(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || data != nil {
+		t.Errorf("Expected no content and no error, got %q and %v", data, err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested")
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := Write(path, []byte(content)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	data, err := Read(path)
+	if err != nil || string(data) != "second" {
+		t.Errorf("Expected the second content, got %q and %v", data, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary file left behind, got %v", entries)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("Expected mode 0644, got %v", info.Mode())
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(path, func(data []byte) ([]byte, error) {
+				n, _ := strconv.Atoi(string(data))
+				return []byte(strconv.Itoa(n + 1)), nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := Read(path)
+	if err != nil || string(data) != "20" {
+		t.Errorf("Expected every update to be kept, got %q and %v", data, err)
+	}
+}
+
+func TestUpdateChangeFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := Write(path, []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Update(path, func([]byte) ([]byte, error) { return nil, fmt.Errorf("invalid") })
+	if err == nil {
+		t.Fatal("Expected the error of the change")
+	}
+	if data, _ := Read(path); string(data) != "kept" {
+		t.Errorf("Expected the file unchanged, got %q", data)
+	}
+}
@@ -0,0 +1,147 @@
+// Package cache persists the account, project and location lists fetched from
+// gcloud so they can be reused across runs, e.g. by shell completion.
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mathd/gcp-switcher/internal/atomicfile"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// Cache is the on-disk cache content
+type Cache struct {
+	Accounts    AccountEntry              `json:"accounts"`
+	Projects    map[string]ProjectsEntry  `json:"projects"`              // Keyed by account
+	Locations   map[string]LocationsEntry `json:"locations,omitempty"`   // Keyed by project
+	Hierarchies map[string]HierarchyEntry `json:"hierarchies,omitempty"` // Keyed by account
+}
+
+// AccountEntry holds the cached account list
+type AccountEntry struct {
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Accounts  []types.Account `json:"items"`
+}
+
+// ProjectsEntry holds the projects visible to one account
+type ProjectsEntry struct {
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Projects  []types.Project `json:"items"`
+}
+
+// LocationsEntry holds the regions and zones available to one project
+type LocationsEntry struct {
+	FetchedAt time.Time      `json:"fetchedAt"`
+	Regions   []types.Region `json:"regions"`
+	Zones     []types.Zone   `json:"zones"`
+}
+
+// HierarchyEntry holds the organizations and folders visible to one account
+type HierarchyEntry struct {
+	FetchedAt     time.Time            `json:"fetchedAt"`
+	Organizations []types.Organization `json:"organizations"`
+	Folders       []types.Folder       `json:"folders"`
+}
+
+// Dir returns the cache directory. It honors GCP_SWITCHER_CACHE_DIR, then
+// the platform user cache directory.
+func Dir() (string, error) {
+	if dir := os.Getenv("GCP_SWITCHER_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gcp-switcher"), nil
+}
+
+// Load reads the cache. A missing cache file yields an empty cache.
+func Load() (Cache, error) {
+	var c Cache
+
+	p, err := path()
+	if err != nil {
+		return c, err
+	}
+	data, err := atomicfile.Read(p)
+	if err != nil || data == nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// Update applies a change to the cache and writes it back
+func Update(change func(c *Cache)) error {
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	return atomicfile.Update(p, func(data []byte) ([]byte, error) {
+		var c Cache
+		if data != nil {
+			if err := json.Unmarshal(data, &c); err != nil {
+				// A corrupt cache is rebuilt rather than blocking updates
+				c = Cache{}
+			}
+		}
+		change(&c)
+		return json.Marshal(c)
+	})
+}
+
+// SetAccounts records the account list
+func (c *Cache) SetAccounts(accounts []types.Account, fetchedAt time.Time) {
+	c.Accounts = AccountEntry{FetchedAt: fetchedAt, Accounts: accounts}
+}
+
+// SetProjects records the projects visible to an account
+func (c *Cache) SetProjects(account string, projects []types.Project, fetchedAt time.Time) {
+	if c.Projects == nil {
+		c.Projects = map[string]ProjectsEntry{}
+	}
+	c.Projects[account] = ProjectsEntry{FetchedAt: fetchedAt, Projects: projects}
+}
+
+// SetLocations records the regions and zones available to a project
+func (c *Cache) SetLocations(projectID string, regions []types.Region, zones []types.Zone, fetchedAt time.Time) {
+	if c.Locations == nil {
+		c.Locations = map[string]LocationsEntry{}
+	}
+	c.Locations[projectID] = LocationsEntry{FetchedAt: fetchedAt, Regions: regions, Zones: zones}
+}
+
+// SetHierarchy records the organizations and folders visible to an account
+func (c *Cache) SetHierarchy(account string, organizations []types.Organization, folders []types.Folder, fetchedAt time.Time) {
+	if c.Hierarchies == nil {
+		c.Hierarchies = map[string]HierarchyEntry{}
+	}
+	c.Hierarchies[account] = HierarchyEntry{FetchedAt: fetchedAt, Organizations: organizations, Folders: folders}
+}
+
+// AllProjects returns the projects cached for every account, without duplicates
+func (c Cache) AllProjects() []types.Project {
+	seen := map[string]bool{}
+	var projects []types.Project
+	for _, entry := range c.Projects {
+		for _, project := range entry.Projects {
+			if !seen[project.ProjectID] {
+				seen[project.ProjectID] = true
+				projects = append(projects, project)
+			}
+		}
+	}
+	return projects
+}
+
+func path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cache.json"), nil
+}
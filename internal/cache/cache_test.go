@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("GCP_SWITCHER_CACHE_DIR", t.TempDir())
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(c.Accounts.Accounts) > 0 || len(c.Projects) > 0 {
+		t.Errorf("Expected an empty cache, got %+v", c)
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	t.Setenv("GCP_SWITCHER_CACHE_DIR", t.TempDir())
+	fetchedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	err := Update(func(c *Cache) {
+		c.SetAccounts([]types.Account{{Account: "alice@example.com", Status: "ACTIVE"}}, fetchedAt)
+		c.SetProjects("alice@example.com", []types.Project{{ProjectID: "alpha-123"}, {ProjectID: "shared-1"}}, fetchedAt)
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// Later updates keep the entries of other accounts
+	err = Update(func(c *Cache) {
+		c.SetProjects("bob@example.com", []types.Project{{ProjectID: "shared-1"}, {ProjectID: "beta-456"}}, fetchedAt)
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	c, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(c.Accounts.Accounts) != 1 || !c.Accounts.FetchedAt.Equal(fetchedAt) {
+		t.Errorf("Expected the account list with its fetch time, got %+v", c.Accounts)
+	}
+	var ids []string
+	for _, project := range c.AllProjects() {
+		ids = append(ids, project.ProjectID)
+	}
+	slices.Sort(ids)
+	if want := []string{"alpha-123", "beta-456", "shared-1"}; !slices.Equal(ids, want) {
+		t.Errorf("Expected the projects of both accounts once each, got %v", ids)
+	}
+}
+
+func TestUpdateRebuildsCorruptCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GCP_SWITCHER_CACHE_DIR", dir)
+	if err := os.WriteFile(filepath.Join(dir, "cache.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(); err == nil {
+		t.Error("Expected Load to report the corrupt cache")
+	}
+	if err := Update(func(c *Cache) { c.SetAccounts([]types.Account{{Account: "alice@example.com"}}, time.Now()) }); err != nil {
+		t.Fatalf("Expected the corrupt cache to be rebuilt, got %v", err)
+	}
+	if c, err := Load(); err != nil || len(c.Accounts.Accounts) != 1 {
+		t.Errorf("Expected the rebuilt cache, got %+v and %v", c, err)
+	}
+}
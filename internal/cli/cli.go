@@ -0,0 +1,522 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/cache"
+	"github.com/mathd/gcp-switcher/internal/gcloudconfig"
+	"github.com/mathd/gcp-switcher/internal/history"
+	"github.com/mathd/gcp-switcher/internal/pin"
+	"github.com/mathd/gcp-switcher/internal/shell"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// Exit codes returned by Run
+const (
+	ExitOK            = 0
+	ExitFailure       = 1
+	ExitUsage         = 2
+	ExitGcloudMissing = 3
+	ExitMismatch      = 4
+)
+
+// Usage describes the non-interactive subcommands
+const Usage = `Usage:
+  gcp-switcher [flags]                  Launch the interactive switcher
+  gcp-switcher current                  Show the active account and project
+  gcp-switcher accounts list            List authenticated accounts
+  gcp-switcher projects list            List accessible projects
+  gcp-switcher account set <email>      Switch the active account
+  gcp-switcher project set <id>         Switch the active project
+  gcp-switcher apply [--check]          Switch to the values pinned in .gcp-switcher.yaml
+  gcp-switcher -                        Switch back to the previous account and project
+  gcp-switcher shell-init <shell>       Print shell integration for bash, zsh or fish
+
+Read commands accept --output (-o) json|yaml|table|plain (default table).
+`
+
+// Options are the global flags that apply to subcommands
+type Options struct {
+	// Export makes switching subcommands print exports in this shell's
+	// syntax instead of changing gcloud's global configuration
+	Export shell.Shell
+}
+
+// app carries the dependencies shared by every subcommand
+type app struct {
+	runner gcp.Runner
+	stdout io.Writer
+	stderr io.Writer
+	format Format
+	export shell.Shell
+	env    map[string]string // Variables exported so far
+}
+
+// Run executes a non-interactive subcommand and returns the process exit code
+func Run(args []string, runner gcp.Runner, options Options, stdout, stderr io.Writer) int {
+	a := app{runner: runner, stdout: stdout, stderr: stderr, export: options.Export, env: map[string]string{}}
+
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Fprint(stdout, Usage)
+		return ExitOK
+	}
+
+	// Shell integration works from local data and does not need gcloud
+	switch args[0] {
+	case "shell-init":
+		if len(args) != 2 {
+			return a.usageError("shell-init requires exactly one shell")
+		}
+		return a.shellInit(args[1])
+	case "complete":
+		if len(args) != 2 {
+			return a.usageError("complete requires projects or accounts")
+		}
+		return a.complete(args[1])
+	}
+
+	if !runner.Available() {
+		fmt.Fprintln(stderr, "Error: Google Cloud SDK (gcloud) is not installed or not in PATH")
+		return ExitGcloudMissing
+	}
+
+	// Commands are a noun followed by a verb, except for current, apply and -
+	command, rest := args[0], args[1:]
+	if command != "current" && command != "apply" && command != "-" && len(rest) > 0 {
+		command, rest = command+" "+rest[0], rest[1:]
+	}
+
+	switch command {
+	case "current", "accounts list", "projects list":
+		format, err := parseOutputFlag(rest)
+		if err != nil {
+			return a.usageError(err.Error())
+		}
+		a.format = format
+
+		switch command {
+		case "current":
+			return a.current()
+		case "accounts list":
+			return a.listAccounts()
+		default:
+			return a.listProjects()
+		}
+	case "apply":
+		return a.apply(rest)
+	case "-":
+		if len(rest) > 0 {
+			return a.usageError(fmt.Sprintf("unexpected argument %q", rest[0]))
+		}
+		return a.switchBack()
+	case "account set":
+		if len(rest) != 1 {
+			return a.usageError("account set requires exactly one account")
+		}
+		return a.switchAccount(rest[0])
+	case "project set":
+		if len(rest) != 1 {
+			return a.usageError("project set requires exactly one project ID")
+		}
+		return a.switchProject(rest[0])
+	}
+
+	return a.usageError(fmt.Sprintf("unknown command %q", strings.Join(args, " ")))
+}
+
+// current prints the active account and project
+func (a app) current() int {
+	accountMsg := gcp.GetActiveAccount(a.runner)()
+	if err, ok := accountMsg.(types.ErrMsg); ok {
+		return a.fail(err)
+	}
+	projectMsg := gcp.GetActiveProject(a.runner)()
+	if err, ok := projectMsg.(types.ErrMsg); ok {
+		return a.fail(err)
+	}
+
+	state := CurrentState{
+		Account: accountMsg.(types.ActiveAccountMsg).Account,
+		Project: projectMsg.(types.ActiveProjectMsg).Project,
+	}
+	return a.write(view{
+		value:  state,
+		header: []string{"ACCOUNT", "PROJECT"},
+		rows:   [][]string{{state.Account, state.Project}},
+		plain:  []string{state.Account, state.Project},
+	})
+}
+
+// listAccounts prints every authenticated account, marking the active one
+func (a app) listAccounts() int {
+	msg := gcp.GetAllAccounts(a.runner)()
+	if err, ok := msg.(types.ErrMsg); ok {
+		return a.fail(err)
+	}
+
+	accounts := msg.(types.AccountListMsg).Accounts
+	cache.Update(func(c *cache.Cache) { c.SetAccounts(accounts, time.Now()) })
+
+	v := view{value: accounts, header: []string{"ACTIVE", "ACCOUNT"}}
+	for _, account := range accounts {
+		active := ""
+		if account.Status == "ACTIVE" {
+			active = "*"
+		}
+		v.rows = append(v.rows, []string{active, account.Account})
+		v.plain = append(v.plain, account.Account)
+	}
+	return a.write(v)
+}
+
+// listProjects prints every accessible project
+func (a app) listProjects() int {
+	msg := gcp.GetSimpleProjects(a.runner)()
+	if err, ok := msg.(types.ErrMsg); ok {
+		return a.fail(err)
+	}
+
+	projects := msg.(types.ProjectListMsg).Projects
+	if props, err := gcloudconfig.Resolve(); err == nil && props.Account != "" {
+		cache.Update(func(c *cache.Cache) { c.SetProjects(props.Account, projects, time.Now()) })
+	}
+
+	v := view{value: projects, header: []string{"PROJECT_ID", "NAME"}}
+	for _, project := range projects {
+		v.rows = append(v.rows, []string{project.ProjectID, project.Name})
+		v.plain = append(v.plain, project.ProjectID)
+	}
+	return a.write(v)
+}
+
+// switchAccount switches the active account
+func (a app) switchAccount(account string) int {
+	step := gcp.SwitchAccount(a.runner, account)
+	if a.export != "" {
+		step = gcp.ExportAccount(a.runner, account)
+	}
+	if err := a.runSteps(step); err != nil {
+		return a.fail(err)
+	}
+	a.recordHistory()
+	return a.done(fmt.Sprintf("Switched to account %s", account))
+}
+
+// switchProject switches the active project
+func (a app) switchProject(projectID string) int {
+	step := gcp.SwitchProject(a.runner, projectID)
+	if a.export != "" {
+		step = gcp.ExportProject(projectID)
+	}
+	if err := a.runSteps(step); err != nil {
+		return a.fail(err)
+	}
+	a.recordHistory()
+	return a.done(fmt.Sprintf("Switched to project %s", projectID))
+}
+
+// runSteps runs switching steps in order, stopping at the first failure.
+// Exported variables apply to the gcloud commands that follow.
+func (a *app) runSteps(steps ...tea.Cmd) error {
+	for _, step := range steps {
+		result := step().(types.OperationResultMsg)
+		if !result.Success {
+			return result.Err
+		}
+		if len(result.Env) > 0 {
+			maps.Copy(a.env, result.Env)
+			a.runner = a.runner.WithEnv(a.env)
+		}
+	}
+	return nil
+}
+
+// done reports a successful switch. In export mode stdout carries the
+// exports for the calling shell to eval, so the summary goes to stderr.
+func (a app) done(summary string) int {
+	if a.export != "" {
+		fmt.Fprint(a.stdout, shell.Export(a.export, a.env))
+		fmt.Fprintln(a.stderr, summary)
+		return ExitOK
+	}
+	fmt.Fprintln(a.stdout, summary)
+	return ExitOK
+}
+
+// exported is a switching step that only exports variables
+func exported(env map[string]string) tea.Cmd {
+	return func() tea.Msg {
+		return types.OperationResultMsg{Success: true, Env: env}
+	}
+}
+
+// switchBack switches to the previous account and project in the history
+func (a app) switchBack() int {
+	h, err := history.Load()
+	if err != nil {
+		return a.fail(err)
+	}
+	active, err := a.activeState()
+	if err != nil {
+		return a.fail(err)
+	}
+
+	previous, ok := h.Previous(active.Account, active.Project)
+	if !ok {
+		return a.fail(errors.New("no previous account or project to switch back to"))
+	}
+
+	var steps []tea.Cmd
+	if previous.Account != active.Account {
+		if a.export != "" {
+			steps = append(steps, gcp.ExportAccount(a.runner, previous.Account))
+		} else {
+			steps = append(steps, gcp.SwitchAccount(a.runner, previous.Account))
+		}
+	}
+	if previous.Project != "" && previous.Project != active.Project {
+		if a.export != "" {
+			steps = append(steps, gcp.ExportProject(previous.Project))
+		} else {
+			steps = append(steps, gcp.SwitchProject(a.runner, previous.Project))
+		}
+	}
+	if err := a.runSteps(steps...); err != nil {
+		return a.fail(err)
+	}
+
+	a.warnHistory(history.Record(previous.Account, previous.Project, time.Now()))
+	if previous.Project != "" {
+		return a.done(fmt.Sprintf("Switched back to %s / %s", previous.Account, previous.Project))
+	}
+	return a.done(fmt.Sprintf("Switched back to %s", previous.Account))
+}
+
+// recordHistory adds the active account and project to the history. A
+// failure is only a warning since the switch itself succeeded.
+func (a app) recordHistory() {
+	active, err := a.activeState()
+	if err == nil {
+		err = history.Record(active.Account, active.Project, time.Now())
+	}
+	a.warnHistory(err)
+}
+
+// warnHistory reports a switch that could not be added to the history
+func (a app) warnHistory(err error) {
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Warning: the switch was not recorded in the history: %v\n", err)
+	}
+}
+
+// apply switches to the values pinned for the working directory. With
+// --check it only reports whether the active values match the pin.
+func (a app) apply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	check := fs.Bool("check", false, "exit non-zero when the active values do not match the pin")
+	if err := fs.Parse(args); err != nil {
+		return a.usageError(err.Error())
+	}
+	if fs.NArg() > 0 {
+		return a.usageError(fmt.Sprintf("unexpected argument %q", fs.Arg(0)))
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return a.fail(err)
+	}
+	p, path, err := pin.Find(dir)
+	if err != nil {
+		return a.fail(err)
+	}
+	display := pin.Display(dir, path)
+
+	if *check {
+		active, err := a.activeState()
+		if err != nil {
+			return a.fail(err)
+		}
+		mismatches := pin.Mismatches(p, active)
+		if len(mismatches) > 0 {
+			fmt.Fprintf(a.stderr, "Active gcloud settings do not match %s:\n", display)
+			for _, mismatch := range mismatches {
+				fmt.Fprintf(a.stderr, "  %s\n", mismatch)
+			}
+			return ExitMismatch
+		}
+		// In export mode stdout is reserved for exports
+		out := a.stdout
+		if a.export != "" {
+			out = a.stderr
+		}
+		fmt.Fprintf(out, "Active gcloud settings match %s\n", display)
+		return ExitOK
+	}
+
+	// The configuration goes first since activating it changes the other values
+	var steps []tea.Cmd
+	if a.export != "" {
+		if p.Configuration != "" {
+			steps = append(steps, gcp.ExportConfiguration(p.Configuration))
+		}
+		if p.Account != "" {
+			steps = append(steps, gcp.ExportAccount(a.runner, p.Account))
+		}
+		if p.Project != "" {
+			steps = append(steps, gcp.ExportProject(p.Project))
+		}
+		if p.Region != "" {
+			steps = append(steps, exported(map[string]string{gcp.EnvRegion: p.Region}))
+		}
+	} else {
+		if p.Configuration != "" {
+			steps = append(steps, gcp.ActivateConfiguration(a.runner, p.Configuration))
+		}
+		if p.Account != "" {
+			steps = append(steps, gcp.SwitchAccount(a.runner, p.Account))
+		}
+		if p.Project != "" {
+			steps = append(steps, gcp.SwitchProject(a.runner, p.Project))
+		}
+		if p.Region != "" {
+			steps = append(steps, gcp.SetProperty(a.runner, gcp.PropertyRegion, p.Region))
+		}
+	}
+	if err := a.runSteps(steps...); err != nil {
+		return a.fail(err)
+	}
+
+	return a.done("Applied " + display)
+}
+
+// activeState returns the active configuration, account, project and region
+func (a app) activeState() (types.Pin, error) {
+	if props, err := gcp.Resolve(a.runner); err == nil {
+		return types.Pin{
+			Configuration: props.Configuration,
+			Account:       props.Account,
+			Project:       props.Project,
+			Region:        props.Region,
+		}, nil
+	}
+
+	var state types.Pin
+	for _, cmd := range []tea.Cmd{
+		gcp.GetActiveAccount(a.runner),
+		gcp.GetActiveProject(a.runner),
+		gcp.GetProperty(a.runner, "compute/region"),
+		gcp.GetConfigurations(a.runner),
+	} {
+		switch msg := cmd().(type) {
+		case types.ErrMsg:
+			return state, msg.Err
+		case types.ActiveAccountMsg:
+			state.Account = msg.Account
+		case types.ActiveProjectMsg:
+			state.Project = msg.Project
+		case types.PropertyMsg:
+			state.Region = msg.Value
+		case types.ConfigurationListMsg:
+			for _, configuration := range msg.Configurations {
+				if configuration.IsActive {
+					state.Configuration = configuration.Name
+				}
+			}
+		}
+	}
+	return state, nil
+}
+
+// shellInit prints the integration script for a shell
+func (a app) shellInit(name string) int {
+	sh, err := shell.Parse(name)
+	if err != nil {
+		return a.usageError(err.Error())
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		binary = "gcp-switcher"
+	}
+
+	script, err := shell.Init(sh, binary)
+	if err != nil {
+		return a.usageError(err.Error())
+	}
+	fmt.Fprint(a.stdout, script)
+	return ExitOK
+}
+
+// complete prints completion candidates from the cache, one per line. Projects
+// are printed as ID and name separated by a tab.
+func (a app) complete(kind string) int {
+	c, err := cache.Load()
+	if err != nil {
+		return a.fail(err)
+	}
+
+	switch kind {
+	case "projects":
+		projects := c.AllProjects()
+		if props, err := gcloudconfig.Resolve(); err == nil {
+			if entry, ok := c.Projects[props.Account]; ok {
+				projects = entry.Projects
+			}
+		}
+		for _, project := range projects {
+			fmt.Fprintf(a.stdout, "%s\t%s\n", project.ProjectID, project.Name)
+		}
+	case "accounts":
+		for _, account := range c.Accounts.Accounts {
+			fmt.Fprintln(a.stdout, account.Account)
+		}
+	default:
+		return a.usageError(fmt.Sprintf("cannot complete %q (want projects or accounts)", kind))
+	}
+	return ExitOK
+}
+
+// write renders a result in the selected output format
+func (a app) write(v view) int {
+	if err := write(a.stdout, a.format, v); err != nil {
+		return a.fail(err)
+	}
+	return ExitOK
+}
+
+// fail reports an error and returns the failure exit code
+func (a app) fail(err error) int {
+	fmt.Fprintf(a.stderr, "Error: %v\n", err)
+	return ExitFailure
+}
+
+// usageError reports a usage error and returns the usage exit code
+func (a app) usageError(message string) int {
+	fmt.Fprintf(a.stderr, "Error: %s\n\n%s", message, Usage)
+	return ExitUsage
+}
+
+// parseOutputFlag parses the flags accepted by read commands
+func parseOutputFlag(args []string) (Format, error) {
+	fs := flag.NewFlagSet("gcp-switcher", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	output := fs.String("output", string(FormatTable), "output format")
+	fs.StringVar(output, "o", string(FormatTable), "output format")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		return "", fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	return ParseFormat(*output)
+}
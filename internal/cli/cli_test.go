@@ -0,0 +1,408 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/history"
+	"github.com/mathd/gcp-switcher/internal/shell"
+)
+
+// isolate points gcloud at an empty configuration directory so that lookups
+// fall back to the runner
+func isolate(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+	t.Setenv("GCP_SWITCHER_CACHE_DIR", t.TempDir())
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", t.TempDir())
+}
+
+func run(runner gcp.Runner, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, runner, Options{}, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunCurrent(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner().
+		Respond("alice@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("alpha-123\n", "config", "get-value", "project")
+
+	code, stdout, _ := run(runner, "current")
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d, got %d", ExitOK, code)
+	}
+	if stdout != "ACCOUNT            PROJECT\nalice@example.com  alpha-123\n" {
+		t.Errorf("Unexpected output: %q", stdout)
+	}
+}
+
+func TestRunOutputFormats(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner().
+		Respond("alice@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("alpha-123\n", "config", "get-value", "project").
+		Respond(`[{"account":"alice@example.com","status":"ACTIVE"}]`, "auth", "list", "--format=json")
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"current", "--output", "json"}, "{\n  \"account\": \"alice@example.com\",\n  \"project\": \"alpha-123\"\n}\n"},
+		{[]string{"current", "-o", "yaml"}, "account: alice@example.com\nproject: alpha-123\n"},
+		{[]string{"current", "-o", "plain"}, "alice@example.com\nalpha-123\n"},
+		{[]string{"accounts", "list", "-o", "json"}, "[\n  {\n    \"account\": \"alice@example.com\",\n    \"status\": \"ACTIVE\"\n  }\n]\n"},
+		{[]string{"accounts", "list", "--output=yaml"}, "- account: alice@example.com\n  status: ACTIVE\n"},
+	}
+
+	for _, tt := range tests {
+		code, stdout, stderr := run(runner, tt.args...)
+		if code != ExitOK {
+			t.Errorf("%v: expected exit code %d, got %d (%s)", tt.args, ExitOK, code, stderr)
+			continue
+		}
+		if stdout != tt.want {
+			t.Errorf("%v: expected %q, got %q", tt.args, tt.want, stdout)
+		}
+	}
+
+	if code, _, _ := run(runner, "current", "-o", "xml"); code != ExitUsage {
+		t.Errorf("Expected exit code %d for unknown format, got %d", ExitUsage, code)
+	}
+}
+
+func TestRunProjectsList(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner().
+		Respond(`[{"name":"Alpha","projectId":"alpha-123"}]`, "projects", "list", "--format=json")
+
+	code, stdout, _ := run(runner, "projects", "list")
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d, got %d", ExitOK, code)
+	}
+	if !strings.Contains(stdout, "alpha-123") || !strings.Contains(stdout, "Alpha") {
+		t.Errorf("Expected project listing, got %q", stdout)
+	}
+}
+
+func TestRunAccountSetNotAuthenticated(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner().
+		Respond("", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)")
+
+	code, _, stderr := run(runner, "account", "set", "bob@example.com")
+	if code != ExitFailure {
+		t.Fatalf("Expected exit code %d, got %d", ExitFailure, code)
+	}
+	if !strings.Contains(stderr, "is not authenticated") {
+		t.Errorf("Expected authentication error, got %q", stderr)
+	}
+	if runner.Called("config", "set", "account", "bob@example.com") {
+		t.Error("Expected the switch to be refused before calling gcloud config set")
+	}
+}
+
+func TestRunProjectSetFailure(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner().
+		Fail(errors.New("exit status 1"), "ERROR: project not found", "config", "set", "project", "missing")
+
+	code, _, stderr := run(runner, "project", "set", "missing")
+	if code != ExitFailure {
+		t.Fatalf("Expected exit code %d, got %d", ExitFailure, code)
+	}
+	if !strings.Contains(stderr, "project not found") {
+		t.Errorf("Expected gcloud output in error, got %q", stderr)
+	}
+}
+
+func TestRunHistoryNotRecorded(t *testing.T) {
+	isolate(t)
+	// The history cannot be written under a regular file
+	blocked := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", blocked)
+	runner := gcp.NewFakeRunner().
+		Respond("", "config", "set", "project", "beta-456").
+		Respond("alice@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("beta-456\n", "config", "get-value", "project").
+		Respond("\n", "config", "get-value", "compute/region").
+		Respond("[]", "config", "configurations", "list", "--format=json")
+
+	code, stdout, stderr := run(runner, "project", "set", "beta-456")
+	if code != ExitOK || stdout != "Switched to project beta-456\n" {
+		t.Fatalf("Expected the switch to succeed, got %d (%q, %s)", code, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "Warning: the switch was not recorded in the history") {
+		t.Errorf("Expected a warning about the history, got %q", stderr)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner()
+
+	if code, _, _ := run(runner, "project", "set"); code != ExitUsage {
+		t.Errorf("Expected exit code %d for missing argument, got %d", ExitUsage, code)
+	}
+	if code, _, _ := run(runner, "bogus"); code != ExitUsage {
+		t.Errorf("Expected exit code %d for unknown command, got %d", ExitUsage, code)
+	}
+
+	runner.Missing = true
+	if code, _, _ := run(runner, "current"); code != ExitGcloudMissing {
+		t.Errorf("Expected exit code %d without gcloud, got %d", ExitGcloudMissing, code)
+	}
+}
+
+func TestRunShellInit(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner()
+	runner.Missing = true // Shell integration must not need gcloud
+
+	for _, sh := range []string{"bash", "zsh", "fish"} {
+		code, stdout, stderr := run(runner, "shell-init", sh)
+		if code != ExitOK {
+			t.Errorf("%s: expected exit code %d, got %d (%s)", sh, ExitOK, code, stderr)
+		}
+		if !strings.Contains(stdout, "gcps") || !strings.Contains(stdout, "--export --shell "+sh) {
+			t.Errorf("%s: expected a gcps wrapper around export mode", sh)
+		}
+	}
+
+	if code, _, _ := run(runner, "shell-init", "powershell"); code != ExitUsage {
+		t.Errorf("Expected exit code %d for powershell, got %d", ExitUsage, code)
+	}
+}
+
+func TestRunCompleteFromCache(t *testing.T) {
+	isolate(t)
+	t.Setenv("CLOUDSDK_CONFIG", "../gcloudconfig/testdata/sdk")
+	runner := gcp.NewFakeRunner().
+		Respond(`[{"name":"Beta","projectId":"beta-456"}]`, "projects", "list", "--format=json")
+
+	// Listing projects fills the cache for the active account
+	if code, _, _ := run(runner, "projects", "list"); code != ExitOK {
+		t.Fatalf("Expected projects list to succeed, got %d", code)
+	}
+
+	runner.Missing = true
+	code, stdout, _ := run(runner, "complete", "projects")
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d, got %d", ExitOK, code)
+	}
+	if stdout != "beta-456\tBeta\n" {
+		t.Errorf("Unexpected completion candidates %q", stdout)
+	}
+}
+
+// writePin creates a pin file in a temporary tree and changes into a nested directory
+func writePin(t *testing.T, content string) {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ".gcp-switcher.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(root, "services", "payments")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(nested)
+}
+
+func TestRunApplyCheck(t *testing.T) {
+	isolate(t)
+	sdk, err := filepath.Abs("../gcloudconfig/testdata/sdk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CLOUDSDK_CONFIG", sdk)
+	runner := gcp.NewFakeRunner()
+
+	writePin(t, "account: bob@example.com\nproject: beta-456\n")
+	if code, stdout, _ := run(runner, "apply", "--check"); code != ExitOK {
+		t.Errorf("Expected matching pin to pass, got %d", code)
+	} else if !strings.Contains(stdout, "../../.gcp-switcher.yaml") {
+		t.Errorf("Expected the pin path in the output, got %q", stdout)
+	}
+
+	writePin(t, "project: prod-789\nregion: europe-west1\n")
+	code, _, stderr := run(runner, "apply", "--check")
+	if code != ExitMismatch {
+		t.Fatalf("Expected exit code %d, got %d", ExitMismatch, code)
+	}
+	if !strings.Contains(stderr, "project: pinned prod-789, active beta-456") {
+		t.Errorf("Expected the mismatch to be described, got %q", stderr)
+	}
+	if len(runner.Calls()) != 0 {
+		t.Errorf("Expected the check to read the configuration files only, got %v", runner.Calls())
+	}
+}
+
+func TestRunApply(t *testing.T) {
+	isolate(t)
+	writePin(t, "account: bob@example.com\nproject: beta-456\nregion: europe-west1\n")
+	runner := gcp.NewFakeRunner().
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)").
+		Respond("", "config", "set", "account", "bob@example.com").
+		Respond("", "config", "set", "project", "beta-456").
+		Respond("", "config", "set", "compute/region", "europe-west1")
+
+	if code, _, stderr := run(runner, "apply"); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d (%s)", code, stderr)
+	}
+	for _, call := range [][]string{
+		{"config", "set", "account", "bob@example.com"},
+		{"config", "set", "project", "beta-456"},
+		{"config", "set", "compute/region", "europe-west1"},
+	} {
+		if !runner.Called(call...) {
+			t.Errorf("Expected gcloud %s to be called", strings.Join(call, " "))
+		}
+	}
+}
+
+func TestRunApplyWithoutPin(t *testing.T) {
+	isolate(t)
+	t.Chdir(t.TempDir())
+
+	code, _, stderr := run(gcp.NewFakeRunner(), "apply")
+	if code != ExitFailure || !strings.Contains(stderr, "not found") {
+		t.Errorf("Expected a failure without a pin file, got %d (%s)", code, stderr)
+	}
+}
+
+func TestRunSwitchBack(t *testing.T) {
+	isolate(t)
+	now := time.Now()
+	history.Record("alice@example.com", "alpha-123", now.Add(-time.Hour))
+	history.Record("bob@example.com", "beta-456", now)
+
+	runner := gcp.NewFakeRunner().
+		Respond("bob@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("beta-456\n", "config", "get-value", "project").
+		Respond("\n", "config", "get-value", "compute/region").
+		Respond("[]", "config", "configurations", "list", "--format=json").
+		Respond("alice@example.com\n", "auth", "list", "--filter=account:alice@example.com", "--format=value(account)").
+		Respond("", "config", "set", "account", "alice@example.com").
+		Respond("", "config", "set", "project", "alpha-123")
+
+	code, stdout, stderr := run(runner, "-")
+	if code != ExitOK {
+		t.Fatalf("Expected switching back to succeed, got %d (%s)", code, stderr)
+	}
+	if stdout != "Switched back to alice@example.com / alpha-123\n" {
+		t.Errorf("Unexpected output: %q", stdout)
+	}
+	if !runner.Called("config", "set", "account", "alice@example.com") || !runner.Called("config", "set", "project", "alpha-123") {
+		t.Errorf("Expected the account and project to be switched, got %v", runner.Calls())
+	}
+
+	h, err := history.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest := h.Entries[0]; latest.Account != "alice@example.com" || latest.Project != "alpha-123" {
+		t.Errorf("Expected the switch back to be recorded, got %+v", latest)
+	}
+}
+
+func TestRunSwitchBackWithoutHistory(t *testing.T) {
+	isolate(t)
+	runner := gcp.NewFakeRunner().
+		Respond("alice@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("alpha-123\n", "config", "get-value", "project").
+		Respond("\n", "config", "get-value", "compute/region").
+		Respond("[]", "config", "configurations", "list", "--format=json")
+
+	code, _, stderr := run(runner, "-")
+	if code != ExitFailure || !strings.Contains(stderr, "no previous") {
+		t.Errorf("Expected a failure without history, got %d (%s)", code, stderr)
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	isolate(t)
+	writePin(t, "account: bob@example.com\nproject: beta-456\nregion: europe-west1\n")
+	runner := gcp.NewFakeRunner().
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)")
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"apply"}, runner, Options{Export: shell.Bash}, &stdout, &stderr); code != ExitOK {
+		t.Fatalf("Expected apply to succeed, got %d (%s)", code, stderr.String())
+	}
+	want := "export CLOUDSDK_COMPUTE_REGION='europe-west1'\nexport CLOUDSDK_CORE_ACCOUNT='bob@example.com'\nexport CLOUDSDK_CORE_PROJECT='beta-456'\n"
+	if stdout.String() != want {
+		t.Errorf("Expected only exports on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Applied") {
+		t.Errorf("Expected the summary on stderr, got %q", stderr.String())
+	}
+	for _, call := range runner.Calls() {
+		if call[0] == "config" && call[1] == "set" {
+			t.Errorf("Expected gcloud's global configuration to be left untouched, got gcloud %s", strings.Join(call, " "))
+		}
+	}
+}
+
+// TestShellCompletionMatchesCommands keeps the completed subcommands in sync
+// with the ones Run dispatches
+func TestShellCompletionMatchesCommands(t *testing.T) {
+	isolate(t)
+	t.Chdir(t.TempDir())
+
+	commands := []string{"help"}
+	for _, line := range strings.Split(Usage, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "gcp-switcher" || strings.HasPrefix(fields[1], "[") {
+			continue
+		}
+		commands = append(commands, fields[1])
+
+		// Every documented command is dispatched, if only to a usage error
+		var args []string
+		for _, field := range fields[1:] {
+			if strings.ContainsAny(field[:1], "<[") {
+				break
+			}
+			args = append(args, field)
+		}
+		if _, _, stderr := run(gcp.NewFakeRunner(), args...); strings.Contains(stderr, "unknown command") {
+			t.Errorf("Expected %q to be dispatched, got %s", strings.Join(args, " "), stderr)
+		}
+	}
+	slices.Sort(commands)
+	commands = slices.Compact(commands)
+
+	patterns := map[shell.Shell]*regexp.Regexp{
+		shell.Bash: regexp.MustCompile(`1\) candidates="([^"]*)"`),
+		shell.Zsh:  regexp.MustCompile(`2\) candidates=\(([^)]*)\)`),
+		shell.Fish: regexp.MustCompile(`__fish_use_subcommand -a '([^']*)'`),
+	}
+	for sh, pattern := range patterns {
+		script, err := shell.Init(sh, "gcp-switcher")
+		if err != nil {
+			t.Fatal(err)
+		}
+		match := pattern.FindStringSubmatch(script)
+		if match == nil {
+			t.Fatalf("%s: no subcommand completion found", sh)
+		}
+		completed := strings.Fields(match[1])
+		slices.Sort(completed)
+		if !slices.Equal(completed, commands) {
+			t.Errorf("%s: expected completion of %v, got %v", sh, commands, completed)
+		}
+	}
+}
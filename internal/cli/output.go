@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format selects how read commands render their results
+type Format string
+
+const (
+	FormatTable Format = "table"
+	FormatPlain Format = "plain"
+	FormatJSON  Format = "json"
+	FormatYAML  Format = "yaml"
+)
+
+// ParseFormat validates an --output value
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(value); format {
+	case FormatTable, FormatPlain, FormatJSON, FormatYAML:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (want json, yaml, table or plain)", value)
+}
+
+// CurrentState is the output schema of the current command
+type CurrentState struct {
+	Account string `json:"account" yaml:"account"`
+	Project string `json:"project" yaml:"project"`
+}
+
+// view describes how a result is rendered in the human-readable formats.
+// The structured formats serialize the value itself.
+type view struct {
+	value  any
+	header []string
+	rows   [][]string
+	plain  []string
+}
+
+// write renders a result in the given format
+func write(w io.Writer, format Format, v view) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v.value)
+
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v.value); err != nil {
+			return err
+		}
+		return encoder.Close()
+
+	case FormatPlain:
+		for _, line := range v.plain {
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range append([][]string{v.header}, v.rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, cell)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUpdateActivateConfiguration(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("Activated [client].", "config", "configurations", "activate", "client")
+
+	m = pressKey(m, "c")
+	if m.StateMachine.GetState() != StateConfigurations {
+		t.Fatalf("Expected StateConfigurations, got %v", m.StateMachine.GetState())
+	}
+	if !strings.Contains(m.View(), "europe-west1") {
+		t.Error("Expected configuration list to show each configuration's region")
+	}
+
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Activate configuration client?") {
+		t.Error("Expected confirmation view to name the selected configuration")
+	}
+
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "configurations", "activate", "client") {
+		t.Error("Expected gcloud config configurations activate to be called")
+	}
+	if m.StateMachine.GetState() != StateMain {
+		t.Errorf("Expected StateMain after activating, got %v", m.StateMachine.GetState())
+	}
+}
+
+func TestUpdateRenameConfiguration(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("Renamed [client].", "config", "configurations", "rename", "client", "--new-name=acme")
+
+	m = pressKey(m, "c")
+	m = pressKey(m, "down")
+	m = pressKey(m, "r")
+	if m.StateMachine.GetState() != StateConfigurationName {
+		t.Fatalf("Expected StateConfigurationName, got %v", m.StateMachine.GetState())
+	}
+
+	m.Components.ConfigurationInput.SetValue("acme")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Rename configuration client to acme?") {
+		t.Error("Expected confirmation view to describe the rename")
+	}
+
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "configurations", "rename", "client", "--new-name=acme") {
+		t.Error("Expected gcloud config configurations rename to be called")
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestUpdateCredentials(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond(`[{"account":"alice@example.com","status":"ACTIVE"},{"account":"ci@alpha-123.iam.gserviceaccount.com","status":""},`+
+		`{"account":"principal://iam.googleapis.com/locations/global/workforcePools/pool/subject/alice","status":""}]`, "auth", "list", "--format=json")
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(keyFile, []byte(`{"type":"service_account","client_email":"deployer@beta-456.iam.gserviceaccount.com"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	runner.Respond("", "auth", "activate-service-account", "--key-file="+keyFile).
+		Respond("", "auth", "revoke", "ci@alpha-123.iam.gserviceaccount.com")
+
+	m = pressKey(m, "i")
+	if m.StateMachine.GetState() != StateCredentials {
+		t.Fatalf("Expected StateCredentials, got %v", m.StateMachine.GetState())
+	}
+	var kinds []string
+	for _, item := range m.Components.CredentialList.Items() {
+		kinds = append(kinds, item.(types.Item).Description())
+	}
+	if want := []string{"User account", "Service account", "External account (workload identity federation)"}; !slices.Equal(kinds, want) {
+		t.Errorf("Expected %v, got %v", want, kinds)
+	}
+
+	// A file that is not a key is refused before anything runs
+	m = pressKey(m, "n")
+	m.Components.KeyFileInput.SetValue(filepath.Join(t.TempDir(), "missing.json"))
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateKeyFile || m.UI.KeyFileErr == nil {
+		t.Fatalf("Expected a missing key file to be reported, got %v", m.StateMachine.GetState())
+	}
+	m.Components.KeyFileInput.SetValue(keyFile)
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Activate service account deployer@beta-456.iam.gserviceaccount.com?") {
+		t.Fatalf("Expected the confirmation to name the service account:\n%s", m.View())
+	}
+	m = pressKey(m, "enter")
+	if !runner.Called("auth", "activate-service-account", "--key-file="+keyFile) {
+		t.Error("Expected the key file to be activated")
+	}
+
+	m = pressKey(m, "i")
+	m.Components.CredentialList.Select(1)
+	m = pressKey(m, "x")
+	m = pressKey(m, "enter")
+	if !runner.Called("auth", "revoke", "ci@alpha-123.iam.gserviceaccount.com") {
+		t.Error("Expected the selected credentials to be revoked")
+	}
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// filterProjects is the project list filter. The filter text is split into
+// terms that must all match: key:value terms match a project label exactly,
+// key: matches any value of that label, and other terms match anywhere in the
+// project ID, name or description, ignoring case.
+func filterProjects(term string, targets []string) []list.Rank {
+	terms := strings.Fields(strings.ToLower(term))
+
+	var ranks []list.Rank
+	for i, target := range targets {
+		if matched, ok := matchProject(terms, strings.ToLower(target)); ok {
+			ranks = append(ranks, list.Rank{Index: i, MatchedIndexes: matched})
+		}
+	}
+	return ranks
+}
+
+// matchProject matches every term against a lowercase filter value and
+// returns the rune indexes matched by plain terms, for highlighting
+func matchProject(terms []string, target string) ([]int, bool) {
+	words := strings.Fields(target)
+
+	var matched []int
+	for _, term := range terms {
+		if key, value, isLabel := strings.Cut(term, ":"); isLabel && key != "" {
+			hasLabel := slices.ContainsFunc(words, func(word string) bool {
+				return word == term || (value == "" && strings.HasPrefix(word, term))
+			})
+			if !hasLabel {
+				return nil, false
+			}
+			continue
+		}
+
+		at := strings.Index(target, term)
+		if at < 0 {
+			return nil, false
+		}
+		start := utf8.RuneCountInString(target[:at])
+		for j := range utf8.RuneCountInString(term) {
+			matched = append(matched, start+j)
+		}
+	}
+
+	slices.Sort(matched)
+	return slices.Compact(matched), true
+}
@@ -0,0 +1,221 @@
+// Package gcloudconfig reads gcloud configuration files directly, avoiding the
+// startup cost of spawning gcloud just to look up a property.
+package gcloudconfig
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ErrNotFound is returned when the active configuration file does not exist
+var ErrNotFound = errors.New("gcloud configuration not found")
+
+// Properties holds the commonly used properties of a configuration
+type Properties struct {
+	Configuration string
+	Account       string
+	Project       string
+	Region        string
+	Zone          string
+	// ImpersonateServiceAccount is the service account gcloud acts as, if any
+	ImpersonateServiceAccount string
+}
+
+// Config is a parsed configuration file
+type Config struct {
+	Name     string
+	Path     string
+	sections map[string]map[string]string
+	env      Env
+}
+
+// Env holds environment variables that take precedence over the process
+// environment, such as those exported to the calling shell in export mode
+type Env map[string]string
+
+// Getenv returns a variable from env, falling back to the process environment
+func (e Env) Getenv(name string) string {
+	if value, ok := e[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Get returns a property as written in the configuration file
+func (c Config) Get(section, key string) string {
+	return c.sections[section][key]
+}
+
+// Effective returns a property the way gcloud resolves it: a
+// CLOUDSDK_<SECTION>_<PROPERTY> environment variable wins over the file.
+func (c Config) Effective(section, key string) string {
+	if value := c.env.Getenv(EnvVar(section, key)); value != "" {
+		return value
+	}
+	return c.Get(section, key)
+}
+
+// EnvVar returns the environment variable that overrides a property
+func EnvVar(section, key string) string {
+	return strings.ToUpper("CLOUDSDK_" + section + "_" + key)
+}
+
+// Dir returns the gcloud configuration directory, honoring CLOUDSDK_CONFIG
+func Dir() (string, error) {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "gcloud"), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gcloud"), nil
+}
+
+// ActiveName returns the name of the active configuration. It honors
+// CLOUDSDK_ACTIVE_CONFIG_NAME, then the active_config file, then "default".
+func ActiveName(dir string) string {
+	return activeName(dir, nil)
+}
+
+// ActiveNameWith returns the name of the active configuration as seen with
+// env set on top of the process environment
+func ActiveNameWith(dir string, env Env) string {
+	return activeName(dir, env)
+}
+
+func activeName(dir string, env Env) string {
+	if name := env.Getenv("CLOUDSDK_ACTIVE_CONFIG_NAME"); name != "" {
+		return name
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "active_config"))
+	if err == nil {
+		if name := strings.TrimSpace(string(data)); name != "" {
+			return name
+		}
+	}
+	return "default"
+}
+
+// ConfigPath returns the path of a named configuration file
+func ConfigPath(dir, name string) string {
+	return filepath.Join(dir, "configurations", "config_"+name)
+}
+
+// Names lists the configurations of a gcloud configuration directory, sorted
+// by name
+func Names(dir string) ([]string, error) {
+	paths, err := filepath.Glob(ConfigPath(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = strings.TrimPrefix(filepath.Base(path), "config_")
+	}
+	return names, nil
+}
+
+// Load reads a named configuration from a gcloud configuration directory
+func Load(dir, name string) (Config, error) {
+	path := ConfigPath(dir, name)
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Config{}, fmt.Errorf("%w: %s", ErrNotFound, path)
+		}
+		return Config{}, err
+	}
+	defer file.Close()
+
+	sections, err := parseINI(bufio.NewScanner(file))
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return Config{Name: name, Path: path, sections: sections}, nil
+}
+
+// LoadActive reads the active configuration
+func LoadActive() (Config, error) {
+	return LoadActiveWith(nil)
+}
+
+// LoadActiveWith reads the active configuration as seen with env set on top
+// of the process environment
+func LoadActiveWith(env Env) (Config, error) {
+	dir, err := Dir()
+	if err != nil {
+		return Config{}, err
+	}
+	config, err := Load(dir, activeName(dir, env))
+	config.env = env
+	return config, err
+}
+
+// Resolve returns the effective properties of the active configuration
+func Resolve() (Properties, error) {
+	return ResolveWith(nil)
+}
+
+// ResolveWith returns the effective properties of the active configuration
+// as seen with env set on top of the process environment
+func ResolveWith(env Env) (Properties, error) {
+	config, err := LoadActiveWith(env)
+	if err != nil {
+		return Properties{}, err
+	}
+	return Properties{
+		Configuration: config.Name,
+		Account:       config.Effective("core", "account"),
+		Project:       config.Effective("core", "project"),
+		Region:        config.Effective("compute", "region"),
+		Zone:          config.Effective("compute", "zone"),
+
+		ImpersonateServiceAccount: config.Effective("auth", "impersonate_service_account"),
+	}, nil
+}
+
+// parseINI parses the INI dialect written by gcloud
+func parseINI(scanner *bufio.Scanner) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	section := ""
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header %q", lineNo, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if sections[section] == nil {
+				sections[section] = map[string]string{}
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNo, line)
+		}
+		if section == "" {
+			return nil, fmt.Errorf("line %d: property %q outside of a section", lineNo, strings.TrimSpace(key))
+		}
+		sections[section][strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return sections, scanner.Err()
+}
@@ -0,0 +1,100 @@
+package gcloudconfig
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResolveActiveConfiguration(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", "testdata/sdk")
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+
+	props, err := Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	want := Properties{
+		Configuration: "work",
+		Account:       "bob@example.com",
+		Project:       "beta-456",
+		Region:        "europe-west1",
+		Zone:          "europe-west1-b",
+	}
+	if props != want {
+		t.Errorf("Expected %+v, got %+v", want, props)
+	}
+}
+
+func TestResolveActiveConfigNameOverride(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", "testdata/sdk")
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "default")
+
+	props, err := Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if props.Configuration != "default" || props.Project != "alpha-123" {
+		t.Errorf("Expected the default configuration, got %+v", props)
+	}
+	if props.Region != "" {
+		t.Errorf("Expected no region, got %q", props.Region)
+	}
+}
+
+func TestResolvePropertyOverride(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", "testdata/sdk")
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "from-env")
+
+	props, err := Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if props.Project != "from-env" {
+		t.Errorf("Expected CLOUDSDK_CORE_PROJECT to win, got %q", props.Project)
+	}
+
+	config, _ := LoadActive()
+	if config.Get("core", "project") != "beta-456" {
+		t.Errorf("Expected Get to return the file value, got %q", config.Get("core", "project"))
+	}
+}
+
+func TestResolveMissingConfiguration(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+
+	if _, err := Resolve(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestResolveWithEnv(t *testing.T) {
+	t.Setenv("CLOUDSDK_CONFIG", "testdata/sdk")
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "from-env")
+
+	props, err := ResolveWith(Env{"CLOUDSDK_ACTIVE_CONFIG_NAME": "default", "CLOUDSDK_CORE_PROJECT": "exported"})
+	if err != nil {
+		t.Fatalf("ResolveWith failed: %v", err)
+	}
+	if props.Configuration != "default" || props.Project != "exported" {
+		t.Errorf("Expected the given variables to win over the process environment, got %+v", props)
+	}
+}
+
+func TestNames(t *testing.T) {
+	names, err := Names("testdata/sdk")
+	if err != nil {
+		t.Fatalf("Names failed: %v", err)
+	}
+	if !slices.Equal(names, []string{"default", "work"}) {
+		t.Errorf("Expected default and work, got %v", names)
+	}
+
+	if names, err := Names(t.TempDir()); err != nil || len(names) != 0 {
+		t.Errorf("Expected no configurations in an empty directory, got %v (%v)", names, err)
+	}
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/ui"
+)
+
+const (
+	accountsJSON = `[{"account":"alice@example.com","status":"ACTIVE"},{"account":"bob@example.com","status":""}]`
+	projectsJSON = `[{"name":"Alpha","projectId":"alpha-123"},{"name":"Beta","projectId":"beta-456"}]`
+	configsJSON  = `[{"name":"default","is_active":true,"properties":{"core":{"account":"alice@example.com","project":"alpha-123"}}},` +
+		`{"name":"client","is_active":false,"properties":{"core":{"account":"bob@example.com","project":"beta-456"},"compute":{"region":"europe-west1"}}}]`
+)
+
+// newFakeRunner scripts the gcloud calls issued during startup. The gcloud
+// configuration directory is pointed at an empty directory so that active
+// account and project lookups fall back to the runner.
+func newFakeRunner(t *testing.T) *gcp.FakeRunner {
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+	t.Setenv("CLOUDSDK_ACTIVE_CONFIG_NAME", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("CLOUDSDK_CORE_ACCOUNT", "")
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	t.Setenv("GCP_SWITCHER_CACHE_DIR", t.TempDir())
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", t.TempDir())
+
+	return gcp.NewFakeRunner().
+		Respond("alice@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("alpha-123\n", "config", "get-value", "project").
+		Respond(accountsJSON, "auth", "list", "--format=json").
+		Respond(projectsJSON, "projects", "list", "--format=json").
+		Respond(configsJSON, "config", "configurations", "list", "--format=json")
+}
+
+// writeGcloudConfig writes the active configuration file, which switches
+// read to know what to restore when a step fails
+func writeGcloudConfig(t *testing.T, contents string) {
+	t.Helper()
+	dir := filepath.Join(os.Getenv("CLOUDSDK_CONFIG"), "configurations")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config_default"), []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runCmd executes a command and returns the messages it produces, flattening
+// batches and sequences. Commands that block (timers, spinner ticks) are dropped.
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+
+	done := make(chan tea.Msg, 1)
+	go func() { done <- cmd() }()
+
+	var msg tea.Msg
+	select {
+	case msg = <-done:
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+
+	switch msg.(type) {
+	case spinner.TickMsg, nil:
+		return nil
+	}
+
+	// Batches and sequences are both slices of commands
+	if v := reflect.ValueOf(msg); v.Kind() == reflect.Slice && v.Type().Elem() == reflect.TypeOf(tea.Cmd(nil)) {
+		var msgs []tea.Msg
+		for i := 0; i < v.Len(); i++ {
+			msgs = append(msgs, runCmd(v.Index(i).Interface().(tea.Cmd))...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
+
+// send feeds a message into the model and processes the resulting commands
+func send(m AppModel, msg tea.Msg) AppModel {
+	next, cmd := m.Update(msg)
+	m = next.(AppModel)
+	for _, result := range runCmd(cmd) {
+		m = send(m, result)
+	}
+	return m
+}
+
+func pressKey(m AppModel, key string) AppModel {
+	switch key {
+	case "enter":
+		return send(m, tea.KeyMsg{Type: tea.KeyEnter})
+	case "down":
+		return send(m, tea.KeyMsg{Type: tea.KeyDown})
+	case "esc":
+		return send(m, tea.KeyMsg{Type: tea.KeyEsc})
+	}
+	return send(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+}
+
+// loadedModel returns a model that has processed the startup commands
+func loadedModel(t *testing.T, runner *gcp.FakeRunner) AppModel {
+	t.Helper()
+
+	m := InitialModel(ui.NewStyles(), runner, userconfig.Config{})
+	m = send(m, tea.WindowSizeMsg{Width: 100, Height: 40})
+	commands := startupCommands(runner)
+	for i, cmd := range commands {
+		if state := m.StateMachine.GetState(); state != StateLoading {
+			t.Fatalf("Expected loading to wait for %d more startup commands, got %v", len(commands)-i, state)
+		}
+		m = send(m, cmd())
+	}
+
+	if m.StateMachine.GetState() != StateMain {
+		t.Fatalf("Expected StateMain after loading, got %v", m.StateMachine.GetState())
+	}
+	return m
+}
+
+// newTestModel returns a model loaded from the startup script of
+// newFakeRunner, and the runner to script the rest of the test on
+func newTestModel(t *testing.T) (AppModel, *gcp.FakeRunner) {
+	t.Helper()
+	runner := newFakeRunner(t)
+	return loadedModel(t, runner), runner
+}
+
+// roundTripFunc serves HTTP requests without touching the network
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
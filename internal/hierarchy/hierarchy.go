@@ -0,0 +1,183 @@
+// Package hierarchy arranges projects into the organization and folder tree
+// they belong to.
+package hierarchy
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/mathd/gcp-switcher/types"
+)
+
+// Kind tells what a node of the tree is
+type Kind int
+
+const (
+	KindOrganization Kind = iota
+	KindFolder
+	KindProject
+)
+
+// Node is an organization, folder or project in the tree
+type Node struct {
+	Kind     Kind
+	ID       string // Resource name for containers, project ID for projects
+	Name     string
+	Project  types.Project
+	Children []*Node
+}
+
+// IsContainer reports whether the node is an organization or folder
+func (n *Node) IsContainer() bool {
+	return n.Kind != KindProject
+}
+
+// Projects returns every project beneath the node, depth first
+func (n *Node) Projects() []types.Project {
+	if n.Kind == KindProject {
+		return []types.Project{n.Project}
+	}
+	var projects []types.Project
+	for _, child := range n.Children {
+		projects = append(projects, child.Projects()...)
+	}
+	return projects
+}
+
+// Row is a visible node and its depth in the tree
+type Row struct {
+	Node  *Node
+	Depth int
+}
+
+// Build arranges projects under their organizations and folders. Parents that
+// were not listed, e.g. for lack of permission, become placeholder folders at
+// the root, and projects without a parent are listed at the root.
+func Build(organizations []types.Organization, folders []types.Folder, projects []types.Project) []*Node {
+	nodes := map[string]*Node{}
+	var roots []*Node
+
+	for _, organization := range organizations {
+		node := &Node{Kind: KindOrganization, ID: organization.Name, Name: organization.DisplayName}
+		nodes[node.ID] = node
+		roots = append(roots, node)
+	}
+	for _, folder := range folders {
+		nodes[folder.Name] = &Node{Kind: KindFolder, ID: folder.Name, Name: folder.DisplayName}
+	}
+
+	// parent returns the node for a resource name, adding a placeholder when it is unknown
+	parent := func(name string) *Node {
+		if node, ok := nodes[name]; ok {
+			return node
+		}
+		node := &Node{Kind: KindFolder, ID: name, Name: name}
+		if strings.HasPrefix(name, "organizations/") {
+			node.Kind = KindOrganization
+		}
+		nodes[name] = node
+		roots = append(roots, node)
+		return node
+	}
+
+	for _, folder := range folders {
+		node := nodes[folder.Name]
+		if folder.Parent == "" {
+			roots = append(roots, node)
+			continue
+		}
+		p := parent(folder.Parent)
+		p.Children = append(p.Children, node)
+	}
+	for _, project := range projects {
+		node := &Node{Kind: KindProject, ID: project.ProjectID, Name: project.Name, Project: project}
+		if project.Parent == nil {
+			roots = append(roots, node)
+			continue
+		}
+		p := parent(project.Parent.ResourceName())
+		p.Children = append(p.Children, node)
+	}
+
+	sortNodes(roots)
+	return roots
+}
+
+// sortNodes puts containers before projects, each sorted by name
+func sortNodes(nodes []*Node) {
+	slices.SortStableFunc(nodes, func(a, b *Node) int {
+		if a.IsContainer() != b.IsContainer() {
+			if a.IsContainer() {
+				return -1
+			}
+			return 1
+		}
+		if a.IsContainer() {
+			return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	for _, node := range nodes {
+		sortNodes(node.Children)
+	}
+}
+
+// Flatten lists the visible nodes in display order. Children are visible when
+// their parent is expanded.
+func Flatten(roots []*Node, expanded func(*Node) bool) []Row {
+	var rows []Row
+	var walk func(nodes []*Node, depth int)
+	walk = func(nodes []*Node, depth int) {
+		for _, node := range nodes {
+			rows = append(rows, Row{Node: node, Depth: depth})
+			if node.IsContainer() && expanded(node) {
+				walk(node.Children, depth+1)
+			}
+		}
+	}
+	walk(roots, 0)
+	return rows
+}
+
+// Find returns the node with the given ID, or nil
+func Find(roots []*Node, id string) *Node {
+	path := Path(roots, id)
+	if len(path) == 0 {
+		return nil
+	}
+	return path[len(path)-1]
+}
+
+// Path returns the nodes from a root down to the node with the given ID, or
+// nil when there is no such node
+func Path(roots []*Node, id string) []*Node {
+	for _, node := range roots {
+		if node.ID == id {
+			return []*Node{node}
+		}
+		if path := Path(node.Children, id); path != nil {
+			return append([]*Node{node}, path...)
+		}
+	}
+	return nil
+}
+
+// Ancestors returns the resource names of the folders and organization
+// containing a project, nearest first. The chain stops at the first folder
+// whose parent is not among the given folders.
+func Ancestors(folders []types.Folder, project types.Project) []string {
+	if project.Parent == nil {
+		return nil
+	}
+	parents := map[string]string{}
+	for _, folder := range folders {
+		parents[folder.Name] = folder.Parent
+	}
+
+	var ancestors []string
+	for name := project.Parent.ResourceName(); name != "" && !slices.Contains(ancestors, name); name = parents[name] {
+		ancestors = append(ancestors, name)
+	}
+	return ancestors
+}
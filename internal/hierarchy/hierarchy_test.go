@@ -0,0 +1,86 @@
+package hierarchy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func testTree() []*Node {
+	organizations := []types.Organization{{Name: "organizations/1", DisplayName: "example.com"}}
+	folders := []types.Folder{
+		{Name: "folders/10", DisplayName: "Payments", Parent: "organizations/1"},
+		{Name: "folders/11", DisplayName: "Prod", Parent: "folders/10"},
+	}
+	projects := []types.Project{
+		{ProjectID: "pay-prod", Parent: &types.ResourceParent{Type: "folder", ID: "11"}},
+		{ProjectID: "pay-dev", Parent: &types.ResourceParent{Type: "folder", ID: "10"}},
+		{ProjectID: "shared", Parent: &types.ResourceParent{Type: "organization", ID: "1"}},
+		{ProjectID: "hidden", Parent: &types.ResourceParent{Type: "folder", ID: "99"}},
+		{ProjectID: "personal"},
+	}
+	return Build(organizations, folders, projects)
+}
+
+func ids(rows []Row) []string {
+	var result []string
+	for _, row := range rows {
+		result = append(result, row.Node.ID)
+	}
+	return result
+}
+
+func TestFlatten(t *testing.T) {
+	roots := testTree()
+
+	collapsed := Flatten(roots, func(*Node) bool { return false })
+	if want := []string{"organizations/1", "folders/99", "personal"}; !reflect.DeepEqual(ids(collapsed), want) {
+		t.Errorf("Expected roots %v, got %v", want, ids(collapsed))
+	}
+
+	expanded := Flatten(roots, func(*Node) bool { return true })
+	want := []string{"organizations/1", "folders/10", "folders/11", "pay-prod", "pay-dev", "shared", "folders/99", "hidden", "personal"}
+	if !reflect.DeepEqual(ids(expanded), want) {
+		t.Errorf("Expected %v, got %v", want, ids(expanded))
+	}
+	if expanded[3].Depth != 3 {
+		t.Errorf("Expected pay-prod at depth 3, got %d", expanded[3].Depth)
+	}
+}
+
+func TestProjectsUnderFolder(t *testing.T) {
+	roots := testTree()
+
+	folder := Find(roots, "folders/10")
+	if folder == nil {
+		t.Fatal("Expected to find folders/10")
+	}
+	var got []string
+	for _, project := range folder.Projects() {
+		got = append(got, project.ProjectID)
+	}
+	if want := []string{"pay-prod", "pay-dev"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if path := Path(roots, "pay-prod"); len(path) != 4 || path[0].ID != "organizations/1" {
+		t.Errorf("Expected the path from the organization, got %d nodes", len(path))
+	}
+}
+
+func TestAncestors(t *testing.T) {
+	folders := []types.Folder{
+		{Name: "folders/10", Parent: "organizations/1"},
+		{Name: "folders/11", Parent: "folders/10"},
+	}
+	project := types.Project{ProjectID: "pay-prod", Parent: &types.ResourceParent{Type: "folder", ID: "11"}}
+
+	want := []string{"folders/11", "folders/10", "organizations/1"}
+	if got := Ancestors(folders, project); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if got := Ancestors(nil, project); !reflect.DeepEqual(got, []string{"folders/11"}) {
+		t.Errorf("Expected only the direct parent without folders, got %v", got)
+	}
+}
@@ -0,0 +1,144 @@
+// Package history persists the most recently used account and project pairs.
+package history
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/mathd/gcp-switcher/internal/atomicfile"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+)
+
+// maxEntries bounds the size of the history file
+const maxEntries = 50
+
+// Entry is a successful switch
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Account string    `json:"account"`
+	Project string    `json:"project,omitempty"`
+}
+
+// History lists switches, most recent first
+type History struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Load reads the history. A missing file yields an empty history.
+func Load() (History, error) {
+	var h History
+
+	p, err := path()
+	if err != nil {
+		return h, err
+	}
+	data, err := atomicfile.Read(p)
+	if err != nil || data == nil {
+		return h, err
+	}
+	err = json.Unmarshal(data, &h)
+	return h, err
+}
+
+// Record adds a switch to the history
+func Record(account, project string, at time.Time) error {
+	p, err := path()
+	if err != nil {
+		return err
+	}
+	return atomicfile.Update(p, func(data []byte) ([]byte, error) {
+		var h History
+		if data != nil {
+			if err := json.Unmarshal(data, &h); err != nil {
+				// A corrupt history is restarted rather than blocking switches
+				h = History{}
+			}
+		}
+		h.Add(Entry{Time: at, Account: account, Project: project})
+		return json.MarshalIndent(h, "", "  ")
+	})
+}
+
+// Add puts an entry first. An account switch that has not been followed by a
+// project switch yet is completed rather than kept as a separate entry.
+func (h *History) Add(entry Entry) {
+	if len(h.Entries) > 0 {
+		latest := h.Entries[0]
+		if latest.Account == entry.Account && (latest.Project == "" || latest.Project == entry.Project) {
+			h.Entries = h.Entries[1:]
+		}
+	}
+	h.Entries = append([]Entry{entry}, h.Entries...)
+	if len(h.Entries) > maxEntries {
+		h.Entries = h.Entries[:maxEntries]
+	}
+}
+
+// Previous returns the most recent entry that differs from the given pair,
+// which is where "gcp-switcher -" goes back to. An account-only entry for the
+// given account counts as the current pair.
+func (h History) Previous(account, project string) (Entry, bool) {
+	for _, entry := range h.Entries {
+		if entry.Account == account && (entry.Project == project || entry.Project == "") {
+			continue
+		}
+		return entry, true
+	}
+	return Entry{}, false
+}
+
+// Recent returns up to n distinct entries, most recent first
+func (h History) Recent(n int) []Entry {
+	type pair struct{ account, project string }
+	seen := map[pair]bool{}
+
+	var recent []Entry
+	for _, entry := range h.Entries {
+		key := pair{entry.Account, entry.Project}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		recent = append(recent, entry)
+		if len(recent) == n {
+			break
+		}
+	}
+	return recent
+}
+
+// LastProject returns the project most recently used with an account
+func (h History) LastProject(account string) (string, bool) {
+	for _, entry := range h.Entries {
+		if entry.Account == account && entry.Project != "" {
+			return entry.Project, true
+		}
+	}
+	return "", false
+}
+
+// ProjectRank returns a project's position by recency, or -1 if it was never used
+func (h History) ProjectRank(projectID string) int {
+	rank := 0
+	seen := map[string]bool{}
+	for _, entry := range h.Entries {
+		if entry.Project == "" || seen[entry.Project] {
+			continue
+		}
+		if entry.Project == projectID {
+			return rank
+		}
+		seen[entry.Project] = true
+		rank++
+	}
+	return -1
+}
+
+func path() (string, error) {
+	dir, err := userconfig.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.json"), nil
+}
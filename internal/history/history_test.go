@@ -0,0 +1,49 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordAndPrevious(t *testing.T) {
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", t.TempDir())
+	now := time.Now()
+
+	for _, entry := range []Entry{
+		{Account: "alice@example.com", Project: "alpha-123"},
+		{Account: "bob@example.com"},
+		{Account: "bob@example.com", Project: "beta-456"},
+	} {
+		if err := Record(entry.Account, entry.Project, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The account-only switch is completed by the project switch that followed it
+	if len(h.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %+v", h.Entries)
+	}
+
+	prev, ok := h.Previous("bob@example.com", "beta-456")
+	if !ok || prev.Account != "alice@example.com" || prev.Project != "alpha-123" {
+		t.Errorf("Expected to go back to alice/alpha-123, got %+v", prev)
+	}
+
+	if project, ok := h.LastProject("alice@example.com"); !ok || project != "alpha-123" {
+		t.Errorf("Expected alpha-123 as the last project of alice, got %q", project)
+	}
+	if _, ok := h.LastProject("carol@example.com"); ok {
+		t.Error("Expected no last project for an account never used")
+	}
+
+	if rank := h.ProjectRank("beta-456"); rank != 0 {
+		t.Errorf("Expected beta-456 to be the most recent project, got rank %d", rank)
+	}
+	if rank := h.ProjectRank("unused"); rank != -1 {
+		t.Errorf("Expected an unused project to have no rank, got %d", rank)
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestUpdateSetLocation(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond(`[{"name":"europe-west1","status":"UP"},{"name":"us-east1","status":"UP"}]`, "compute", "regions", "list", "--format=json").
+		Respond(`[{"name":"europe-west1-b","region":"https://www.googleapis.com/compute/v1/projects/alpha-123/regions/europe-west1","status":"UP"},`+
+			`{"name":"us-east1-c","region":"https://www.googleapis.com/compute/v1/projects/alpha-123/regions/us-east1","status":"UP"}]`,
+			"compute", "zones", "list", "--format=json").
+		Respond("", "config", "set", "compute/region", "us-east1").
+		Respond("", "config", "set", "compute/zone", "us-east1-c").
+		Respond("", "config", "set", "compute/region", "europe-west1").
+		Respond("", "config", "unset", "compute/zone").
+		Respond("", "config", "set", "project", "beta-456").
+		Respond("", "config", "set", "project", "alpha-123")
+
+	m = pressKey(m, "r")
+	if m.StateMachine.GetState() != StateRegions {
+		t.Fatalf("Expected StateRegions once the locations are loaded, got %v", m.StateMachine.GetState())
+	}
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateZones {
+		t.Fatalf("Expected StateZones, got %v", m.StateMachine.GetState())
+	}
+	if items := m.Components.ZoneList.Items(); len(items) != 2 || items[1].(types.Item).ID() != "us-east1-c" {
+		t.Fatalf("Expected the option to clear the zone and the zones of us-east1, got %v", items)
+	}
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Set region us-east1 and zone us-east1-c?") {
+		t.Fatalf("Expected the confirmation to name the region and zone:\n%s", m.View())
+	}
+
+	runner.Respond("us-east1\n", "config", "get-value", "compute/region").
+		Respond("us-east1-c\n", "config", "get-value", "compute/zone")
+	m = pressKey(m, "enter")
+	if m.Data.ActiveRegion != "us-east1" || m.Data.ActiveZone != "us-east1-c" {
+		t.Fatalf("Expected us-east1/us-east1-c to be active, got %q/%q", m.Data.ActiveRegion, m.Data.ActiveZone)
+	}
+	if got := m.Settings.ProjectLocations["alpha-123"]; got != (userconfig.Location{Region: "us-east1", Zone: "us-east1-c"}) {
+		t.Errorf("Expected the location to be remembered for alpha-123, got %+v", got)
+	}
+
+	// Switching away and back restores the project's location
+	m.Settings.SetProjectLocation("beta-456", userconfig.Location{Region: "europe-west1"})
+	runner.Respond("beta-456\n", "config", "get-value", "project").
+		Respond("europe-west1\n", "config", "get-value", "compute/region").
+		Respond("\n", "config", "get-value", "compute/zone")
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "set", "compute/region", "europe-west1") {
+		t.Fatal("Expected the location remembered for beta-456 to be applied")
+	}
+
+	runner.Respond("alpha-123\n", "config", "get-value", "project").
+		Respond("us-east1\n", "config", "get-value", "compute/region").
+		Respond("us-east1-c\n", "config", "get-value", "compute/zone")
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if m.Data.ActiveProject != "alpha-123" || m.Data.ActiveRegion != "us-east1" || m.Data.ActiveZone != "us-east1-c" {
+		t.Errorf("Expected alpha-123 in us-east1/us-east1-c, got %q in %q/%q", m.Data.ActiveProject, m.Data.ActiveRegion, m.Data.ActiveZone)
+	}
+	if saved, _ := userconfig.Load(); saved.ProjectLocations["alpha-123"].Zone != "us-east1-c" {
+		t.Errorf("Expected the location to be saved, got %+v", saved.ProjectLocations)
+	}
+}
+
+func TestUpdateProjectLocationFails(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("", "config", "set", "project", "beta-456").
+		Fail(errors.New("exit status 1"), "ERROR: (gcloud.config.set) Invalid region", "config", "set", "compute/region", "europe-west9").
+		Respond("", "config", "set", "project", "alpha-123")
+	writeGcloudConfig(t, "[core]\naccount = alice@example.com\nproject = alpha-123\n\n[compute]\nzone = europe-west1-b\n")
+	m.Settings.SetProjectLocation("beta-456", userconfig.Location{Region: "europe-west9"})
+
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateError {
+		t.Fatalf("Expected the failed location to be reported, got %v", m.StateMachine.GetState())
+	}
+	if view := m.View(); !strings.Contains(view, "Invalid region") || !strings.Contains(view, "previous settings were restored") {
+		t.Errorf("Expected the region error and the rollback in the view:\n%s", view)
+	}
+	if !runner.Called("config", "set", "project", "alpha-123") {
+		t.Error("Expected the previous project to be restored")
+	}
+	if runner.Called("config", "unset", "compute/zone") {
+		t.Error("Expected no step to run after the failed region")
+	}
+}
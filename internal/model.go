@@ -1,6 +1,11 @@
 package internal
 
 import (
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -8,6 +13,12 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/cache"
+	"github.com/mathd/gcp-switcher/internal/hierarchy"
+	"github.com/mathd/gcp-switcher/internal/history"
+	"github.com/mathd/gcp-switcher/internal/pin"
+	"github.com/mathd/gcp-switcher/internal/shell"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
 	"github.com/mathd/gcp-switcher/types"
 	"github.com/mathd/gcp-switcher/ui"
 )
@@ -23,35 +34,123 @@ const (
 	LoadingInitial LoadingContext = iota
 	LoadingAccounts
 	LoadingProjects
+	LoadingConfigurations
+	LoadingHierarchy
+	LoadingLocations
+	LoadingCredentials
+	LoadingAllProjects
 )
 
+// menuItem describes an entry of the main menu
+type menuItem struct {
+	Choice int
+	Label  string
+	Key    string
+}
+
+// mainMenu lists the main menu entries in display order. Number keys are
+// reserved for favorite projects.
+var mainMenu = []menuItem{
+	{Choice: MenuAccounts, Label: " View/Switch Accounts ", Key: "a"},
+	{Choice: MenuProjects, Label: " View/Switch Projects ", Key: "p"},
+	{Choice: MenuLogin, Label: " Login to a New Account ", Key: "l"},
+	{Choice: MenuManualProject, Label: " Enter Project ID Manually ", Key: "m"},
+	{Choice: MenuConfigurations, Label: " Manage Configurations ", Key: "c"},
+	{Choice: MenuHierarchy, Label: " Browse Organization Tree ", Key: "o"},
+	{Choice: MenuLocation, Label: " Set Region/Zone ", Key: "r"},
+	{Choice: MenuADC, Label: " Application Default Credentials ", Key: "d"},
+	{Choice: MenuCredentials, Label: " Manage Credentials ", Key: "i"},
+	{Choice: MenuAllProjects, Label: " Search Projects of All Accounts ", Key: "s"},
+	{Choice: MenuProfiles, Label: " Switch Profile ", Key: "f"},
+}
+
+// maxFavoriteShortcuts is the number of favorites reachable with number keys
+const maxFavoriteShortcuts = 9
+
+// recentShortcuts are the keys of the recent switches listed on the main
+// screen, one per entry, in order
+const recentShortcuts = "vwxyz"
+
 // AppData holds application data state
 type AppData struct {
-	Accounts      []types.Account
-	Projects      []types.Project
-	ActiveAccount string
-	ActiveProject string
+	Accounts            []types.Account
+	Projects            []types.Project
+	Configurations      []types.Configuration
+	Credentials         []types.Credential
+	AllProjects         []types.AccountProjects // Projects of every account, from the cross-account search
+	ActiveAccount       string
+	ActiveProject       string
+	ActiveConfiguration string
+	ActiveRegion        string
+	ActiveZone          string
+	Impersonating       string // Service account gcloud acts as, if any
+	Regions             []types.Region
+	Zones               []types.Zone
+	Exports             map[string]string // Variables exported to the calling shell in export mode
+	Pin                 types.PinMsg      // Pin file governing the working directory, if any
+	Drift               []types.Drift     // Sources winning over the active account and project
+	History             history.History   // Recently used account and project pairs
+	Organizations       []types.Organization
+	Folders             []types.Folder
+	HierarchyErr        error             // Why the organization tree is incomplete, if it is
+	HierarchyLoading    bool              // Set while the tree is fetched for folder protection rules
+	Hierarchy           []*hierarchy.Node // Roots of the organization tree
+	AccountsSource      ListSource
+	ProjectsSource      ListSource
+	LocationsSource     ListSource
+	ADC                 types.ADC
+	ADCErr              error // Why the ADC file could not be read, if it could not
+}
+
+// ListSource tells whether a displayed list came from the on-disk cache
+type ListSource struct {
+	CachedAt   time.Time // Zero once the list was fetched from gcloud
+	Refreshing bool      // A background refresh is in flight
 }
 
 // UIComponents holds all UI component state
 type UIComponents struct {
-	AccountList  list.Model
-	ProjectList  list.Model
-	Spinner      spinner.Model
-	SearchInput  textinput.Model
-	ProjectInput textinput.Model
+	AccountList        list.Model
+	ProjectList        list.Model
+	ConfigurationList  list.Model
+	HierarchyList      list.Model
+	RegionList         list.Model
+	ZoneList           list.Model
+	CredentialList     list.Model
+	AllProjectsList    list.Model
+	ProfileList        list.Model
+	Spinner            spinner.Model
+	SearchInput        textinput.Model
+	ProjectInput       textinput.Model
+	ConfigurationInput textinput.Model
+	ConfirmInput       textinput.Model
+	QuotaInput         textinput.Model
+	KeyFileInput       textinput.Model
 }
 
 // UIState holds UI-specific state
 type UIState struct {
-	Width              int
-	Height             int
-	Loaded             bool
-	Err                error
-	ConfirmationChoice int
-	MainMenuChoice     int
-	Styles             ui.Styles
-	NeedProjectSelection bool // Flag to trigger project selection after account switch
+	Width                 int
+	Height                int
+	Loaded                bool
+	Err                   error
+	ConfirmationChoice    int
+	MainMenuChoice        int
+	Styles                ui.Styles
+	NeedProjectSelection  bool            // Flag to trigger project selection after account switch
+	RestoreProject        string          // Project restored once the switched-to account's projects are listed
+	ShowLoggedInAccount   bool            // Open the account list once it is refreshed after a login
+	AccountsBeforeLogin   []string        // Accounts known before the login, to spot the new one
+	RenamingConfiguration string          // Configuration being renamed; empty when creating one
+	ConfirmMismatch       bool            // The typed confirmation did not match the protected project
+	Expanded              map[string]bool // Expanded organizations and folders of the tree
+	HierarchyFocus        string          // Folder or organization the tree is narrowed to
+	SelectedRegion        string          // Region whose zones are listed
+	KeyFileErr            error           // Why the entered key file cannot be activated
+	CheckingAccounts      bool            // Account tokens are being checked for the cleanup
+	AccountCheckErr       error           // Why the account tokens could not be checked
+	InvalidAccounts       []string        // Accounts found by the cleanup check
+	SaveErr               error           // Why config.yaml or the history could not be saved
 }
 
 // OperationState holds operation tracking state
@@ -66,6 +165,15 @@ type AppModel struct {
 	// State machine for formal state management
 	StateMachine *AppStateMachine
 
+	// Gcloud executes every gcloud invocation issued by the model
+	Gcloud gcp.Runner
+
+	// HTTP looks up the identity behind Application Default Credentials
+	HTTP *http.Client
+
+	// Settings holds the user settings, with command line overrides applied
+	Settings userconfig.Config
+
 	// Grouped state components
 	Data       AppData
 	Components UIComponents
@@ -75,19 +183,52 @@ type AppModel struct {
 
 // Init initializes the application model
 func (m AppModel) Init() tea.Cmd {
-	return tea.Batch(
+	// Export mode switches through the environment on purpose
+	var verifyCmd tea.Cmd
+	if !m.Settings.ExportMode() {
+		verifyCmd = gcp.VerifySwitch(m.Gcloud, gcp.Context{})
+	}
+
+	return tea.Batch(append(startupCommands(m.Gcloud),
 		m.Components.Spinner.Tick,
-		gcp.CheckGcloud,
-		gcp.GetActiveAccount(),
-		gcp.GetActiveProject(),
-		gcp.GetAllAccounts(),
-		gcp.GetSimpleProjects(),
+		optionalProperty(m.Gcloud, gcp.PropertyRegion),
+		optionalProperty(m.Gcloud, gcp.PropertyZone),
+		optionalProperty(m.Gcloud, gcp.PropertyImpersonation),
+		gcp.GetADC(m.Gcloud),
+		findPin,
+		verifyCmd,
 		createFallbackTimer(10),
-	)
+	)...)
+}
+
+// startupCommands are the commands the loading screen waits for. Each one
+// reports exactly one message counted in CommandsComplete.
+func startupCommands(r gcp.Runner) []tea.Cmd {
+	return []tea.Cmd{
+		gcp.CheckGcloud(r),
+		gcp.GetActiveAccount(r),
+		gcp.GetActiveProject(r),
+		loadAccounts(r),
+		loadProjects(r),
+		gcp.GetConfigurations(r),
+	}
 }
 
-// InitialModel creates and returns the initial application model
-func InitialModel(styles ui.Styles) AppModel {
+// optionalProperty looks up a property that may well be unset, such as the
+// default region. A failed lookup does not count against the startup commands.
+func optionalProperty(r gcp.Runner, property string) tea.Cmd {
+	lookup := gcp.GetProperty(r, property)
+	return func() tea.Msg {
+		if msg, ok := lookup().(types.PropertyMsg); ok {
+			return msg
+		}
+		return nil
+	}
+}
+
+// InitialModel creates and returns the initial application model.
+// All gcloud invocations go through the given runner.
+func InitialModel(styles ui.Styles, runner gcp.Runner, settings userconfig.Config) AppModel {
 	// Initialize spinner
 	s := spinner.New()
 	s.Spinner = spinner.Dot
@@ -107,6 +248,86 @@ func InitialModel(styles ui.Styles) AppModel {
 	pi.CharLimit = 50
 	pi.Width = 30
 
+	// Initialize configuration name input
+	ci := textinput.New()
+	ci.Placeholder = "Enter configuration name..."
+	ci.CharLimit = 50
+	ci.Width = 30
+
+	// Initialize region list
+	regionList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	regionList.Title = "Compute Regions"
+	regionList.SetShowTitle(true)
+	regionList.SetShowStatusBar(true)
+	regionList.SetFilteringEnabled(true)
+	regionList.Styles.Title = styles.Title
+	regionList.Styles.PaginationStyle = styles.Subtitle
+	regionList.Styles.HelpStyle = styles.Info
+
+	// Initialize zone list; its title names the selected region
+	zoneList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	zoneList.SetShowTitle(true)
+	zoneList.SetShowStatusBar(true)
+	zoneList.SetFilteringEnabled(true)
+	zoneList.Styles.Title = styles.Title
+	zoneList.Styles.PaginationStyle = styles.Subtitle
+	zoneList.Styles.HelpStyle = styles.Info
+
+	// Initialize typed confirmation input for protected projects
+	confirmInput := textinput.New()
+	confirmInput.Placeholder = "Type the project ID..."
+	confirmInput.CharLimit = 50
+	confirmInput.Width = 30
+
+	// Initialize ADC quota project input
+	quotaInput := textinput.New()
+	quotaInput.Placeholder = "Enter project ID..."
+	quotaInput.CharLimit = 50
+	quotaInput.Width = 30
+
+	// Initialize service account key file input
+	keyFileInput := textinput.New()
+	keyFileInput.Placeholder = "Path to a JSON key file..."
+	keyFileInput.CharLimit = 256
+	keyFileInput.Width = 50
+
+	// Initialize credential inventory
+	credentialList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	credentialList.Title = "Credentials"
+	credentialList.SetShowTitle(true)
+	credentialList.SetShowStatusBar(true)
+	credentialList.SetFilteringEnabled(true)
+	credentialList.Styles.Title = styles.Title
+	credentialList.Styles.PaginationStyle = styles.Subtitle
+	credentialList.Styles.HelpStyle = styles.Info
+
+	// Initialize cross-account project list
+	allProjectsList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	allProjectsList.Title = "Projects of All Accounts"
+	allProjectsList.SetShowTitle(true)
+	allProjectsList.SetShowStatusBar(true)
+	allProjectsList.SetFilteringEnabled(true)
+	allProjectsList.Filter = filterProjects
+	allProjectsList.Styles.Title = styles.Title
+	allProjectsList.Styles.PaginationStyle = styles.Subtitle
+	allProjectsList.Styles.HelpStyle = styles.Info
+
+	// Initialize profile picker
+	profileList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	profileList.Title = "Profiles"
+	profileList.SetShowTitle(true)
+	profileList.SetShowStatusBar(true)
+	profileList.SetFilteringEnabled(true)
+	profileList.Styles.Title = styles.Title
+	profileList.Styles.PaginationStyle = styles.Subtitle
+	profileList.Styles.HelpStyle = styles.Info
+
+	// Profiles are the usual way to switch once some are defined
+	menuChoice := MenuAccounts
+	if len(settings.Profiles) > 0 {
+		menuChoice = MenuProfiles
+	}
+
 	// Initialize account list
 	accountList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
 	accountList.Title = "GCP Accounts"
@@ -123,35 +344,83 @@ func InitialModel(styles ui.Styles) AppModel {
 	projectList.SetShowTitle(true)
 	projectList.SetShowStatusBar(true)
 	projectList.SetFilteringEnabled(true)
+	projectList.Filter = filterProjects
 	projectList.Styles.Title = styles.Title
 	projectList.Styles.PaginationStyle = styles.Subtitle
 	projectList.Styles.HelpStyle = styles.Info
 
+	// Initialize configuration list
+	configurationList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	configurationList.Title = "gcloud Configurations"
+	configurationList.SetShowTitle(true)
+	configurationList.SetShowStatusBar(true)
+	configurationList.SetFilteringEnabled(true)
+	configurationList.Styles.Title = styles.Title
+	configurationList.Styles.PaginationStyle = styles.Subtitle
+	configurationList.Styles.HelpStyle = styles.Info
+
+	// Initialize organization tree list. Paging keys are limited to PgUp/PgDn
+	// so that the arrow keys can collapse and expand folders.
+	hierarchyList := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
+	hierarchyList.Title = "Organization Tree"
+	hierarchyList.SetShowTitle(true)
+	hierarchyList.SetShowStatusBar(true)
+	hierarchyList.SetFilteringEnabled(true)
+	hierarchyList.Filter = filterProjects
+	hierarchyList.Styles.Title = styles.Title
+	hierarchyList.Styles.PaginationStyle = styles.Subtitle
+	hierarchyList.Styles.HelpStyle = styles.Info
+	hierarchyList.KeyMap.NextPage.SetKeys("pgdown")
+	hierarchyList.KeyMap.PrevPage.SetKeys("pgup")
+
 	// Initialize state machine
 	stateMachine := NewAppStateMachine()
+	stateMachine.SetExportMode(settings.ExportMode())
+
+	// History is best effort; a missing or unreadable file starts empty
+	recent, _ := history.Load()
 
 	return AppModel{
 		StateMachine: stateMachine,
+		Gcloud:       runner,
+		HTTP:         http.DefaultClient,
+		Settings:     settings,
 		Data: AppData{
-			Accounts:      []types.Account{},
-			Projects:      []types.Project{},
-			ActiveAccount: "",
-			ActiveProject: "",
+			Accounts:       []types.Account{},
+			Projects:       []types.Project{},
+			Configurations: []types.Configuration{},
+			ActiveAccount:  "",
+			ActiveProject:  "",
+			Exports:        map[string]string{},
+			History:        recent,
 		},
 		Components: UIComponents{
-			Spinner:      s,
-			SearchInput:  ti,
-			ProjectInput: pi,
-			AccountList:  accountList,
-			ProjectList:  projectList,
+			Spinner:            s,
+			SearchInput:        ti,
+			ProjectInput:       pi,
+			ConfigurationInput: ci,
+			ConfirmInput:       confirmInput,
+			QuotaInput:         quotaInput,
+			KeyFileInput:       keyFileInput,
+			AccountList:        accountList,
+			ProjectList:        projectList,
+			ConfigurationList:  configurationList,
+			HierarchyList:      hierarchyList,
+			RegionList:         regionList,
+			ZoneList:           zoneList,
+			CredentialList:     credentialList,
+			AllProjectsList:    allProjectsList,
+			ProfileList:        profileList,
 		},
 		UI: UIState{
 			ConfirmationChoice: 0,
+			MainMenuChoice:     menuChoice,
 			Styles:             styles,
+			Expanded:           map[string]bool{},
 		},
 		Operations: OperationState{
 			CommandsComplete: 0,
-			TotalCommands:    4,
+			TotalCommands:    len(startupCommands(runner)),
 			CommandErrors:    []string{},
 		},
 	}
@@ -165,6 +434,101 @@ func CheckCompletion(m *AppModel) {
 	}
 }
 
+// findPin looks for a pin file governing the working directory
+func findPin() tea.Msg {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	p, path, err := pin.Find(dir)
+	if errors.Is(err, pin.ErrNotFound) {
+		return nil
+	}
+	return types.PinMsg{Pin: p, Path: pin.Display(dir, path), Err: err}
+}
+
+// loadAccounts serves the account list from the cache when there is one, so
+// the main screen does not wait on gcloud. Stale lists are refreshed by Update.
+func loadAccounts(r gcp.Runner) tea.Cmd {
+	return func() tea.Msg {
+		if c, err := cache.Load(); err == nil && !c.Accounts.FetchedAt.IsZero() {
+			return types.AccountListMsg{Accounts: c.Accounts.Accounts, CachedAt: c.Accounts.FetchedAt}
+		}
+		return gcp.GetAllAccounts(r)()
+	}
+}
+
+// loadProjects serves the active account's project list from the cache when
+// there is one. Stale lists are refreshed by Update.
+func loadProjects(r gcp.Runner) tea.Cmd {
+	return func() tea.Msg {
+		if props, err := gcp.Resolve(r); err == nil {
+			if c, err := cache.Load(); err == nil {
+				if entry, ok := c.Projects[props.Account]; ok {
+					return types.ProjectListMsg{Projects: entry.Projects, CachedAt: entry.FetchedAt}
+				}
+			}
+		}
+		return gcp.GetSimpleProjects(r)()
+	}
+}
+
+// loadLocations serves the active project's regions and zones from the cache
+// when there is one. Stale lists are refreshed by Update.
+func loadLocations(r gcp.Runner) tea.Cmd {
+	return func() tea.Msg {
+		if props, err := gcp.Resolve(r); err == nil {
+			if c, err := cache.Load(); err == nil {
+				if entry, ok := c.Locations[props.Project]; ok {
+					return types.LocationListMsg{Regions: entry.Regions, Zones: entry.Zones, CachedAt: entry.FetchedAt}
+				}
+			}
+		}
+		return gcp.GetLocations(r)()
+	}
+}
+
+// loadHierarchy serves the active account's organization tree from the cache
+// when there is one. Stale trees are refreshed by Update.
+func loadHierarchy(r gcp.Runner) tea.Cmd {
+	return func() tea.Msg {
+		if props, err := gcp.Resolve(r); err == nil {
+			if c, err := cache.Load(); err == nil {
+				if entry, ok := c.Hierarchies[props.Account]; ok {
+					return types.HierarchyMsg{Organizations: entry.Organizations, Folders: entry.Folders, CachedAt: entry.FetchedAt}
+				}
+			}
+		}
+		return gcp.GetHierarchy(r)()
+	}
+}
+
+// searchProjects lists the projects of every account. Lists cached less than
+// maxAge ago are reused; the others are fetched from gcloud in parallel.
+func searchProjects(r gcp.Runner, accounts []string, maxAge time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		// A missing or unreadable cache means everything is fetched
+		c, _ := cache.Load()
+
+		var results []types.AccountProjects
+		var stale []string
+		for _, account := range accounts {
+			if entry, ok := c.Projects[account]; ok && time.Since(entry.FetchedAt) < maxAge {
+				results = append(results, types.AccountProjects{Account: account, Projects: entry.Projects, CachedAt: entry.FetchedAt})
+			} else {
+				stale = append(stale, account)
+			}
+		}
+		if len(stale) > 0 {
+			fetched := gcp.SearchProjects(r, stale)().(types.ProjectSearchMsg)
+			results = append(results, fetched.Results...)
+		}
+
+		slices.SortFunc(results, func(a, b types.AccountProjects) int { return strings.Compare(a.Account, b.Account) })
+		return types.ProjectSearchMsg{Results: results}
+	}
+}
+
 // createFallbackTimer creates a timer to prevent infinite loading
 func createFallbackTimer(seconds int) tea.Cmd {
 	return func() tea.Msg {
@@ -172,3 +536,16 @@ func createFallbackTimer(seconds int) tea.Cmd {
 		return types.FallbackTimerMsg{TimeoutSeconds: seconds}
 	}
 }
+
+// ExportScript returns the shell statements for everything exported during the
+// session, or an empty string when nothing was exported
+func (m AppModel) ExportScript() string {
+	if len(m.Data.Exports) == 0 {
+		return ""
+	}
+	sh := shell.Detect()
+	if parsed, err := shell.Parse(m.Settings.Shell); err == nil {
+		sh = parsed
+	}
+	return shell.Export(sh, m.Data.Exports)
+}
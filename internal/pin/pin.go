@@ -0,0 +1,94 @@
+// Package pin discovers the per-directory .gcp-switcher.yaml file that pins
+// a working tree to an account, project, region and configuration.
+package pin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mathd/gcp-switcher/types"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the pin file
+const FileName = ".gcp-switcher.yaml"
+
+// ErrNotFound is returned when no pin file exists in the directory or its parents
+var ErrNotFound = errors.New(FileName + " not found")
+
+// Find walks up from dir and loads the first pin file it finds. It returns
+// the pin and the path of the file.
+func Find(dir string) (types.Pin, string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return types.Pin{}, "", err
+	}
+
+	for {
+		path := filepath.Join(dir, FileName)
+		if _, err := os.Stat(path); err == nil {
+			pin, err := Load(path)
+			return pin, path, err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return types.Pin{}, "", ErrNotFound
+		}
+		dir = parent
+	}
+}
+
+// Load reads a pin file
+func Load(path string) (types.Pin, error) {
+	var pin types.Pin
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pin, err
+	}
+	if err := yaml.Unmarshal(data, &pin); err != nil {
+		return pin, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if pin == (types.Pin{}) {
+		return pin, fmt.Errorf("%s does not pin anything", path)
+	}
+	return pin, nil
+}
+
+// Display returns the pin file path relative to dir, the way it is shown to users
+func Display(dir, path string) string {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	if !filepath.IsLocal(rel) {
+		return rel
+	}
+	return "." + string(filepath.Separator) + rel
+}
+
+// Mismatches compares a pin with the active values and describes every
+// pinned value that differs
+func Mismatches(pin types.Pin, active types.Pin) []string {
+	var mismatches []string
+	check := func(name, pinned, current string) {
+		if pinned != "" && pinned != current {
+			mismatches = append(mismatches, fmt.Sprintf("%s: pinned %s, active %s", name, pinned, orUnset(current)))
+		}
+	}
+	check("configuration", pin.Configuration, active.Configuration)
+	check("account", pin.Account, active.Account)
+	check("project", pin.Project, active.Project)
+	check("region", pin.Region, active.Region)
+	return mismatches
+}
+
+func orUnset(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
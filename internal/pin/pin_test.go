@@ -0,0 +1,79 @@
+package pin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func writePin(t *testing.T, dir, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFindWalksUp(t *testing.T) {
+	root := t.TempDir()
+	want := writePin(t, root, "account: bob@example.com\nproject: beta-456\n")
+	nested := filepath.Join(root, "services", "api")
+	if err := os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	pin, path, err := Find(nested)
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if path != want || pin.Account != "bob@example.com" || pin.Project != "beta-456" {
+		t.Errorf("Expected the pin of the parent directory, got %+v from %s", pin, path)
+	}
+	if display := Display(nested, path); display != filepath.Join("..", "..", FileName) {
+		t.Errorf("Expected the path relative to the working directory, got %s", display)
+	}
+	if display := Display(root, path); display != "."+string(filepath.Separator)+FileName {
+		t.Errorf("Expected ./%s, got %s", FileName, display)
+	}
+}
+
+func TestFindMissing(t *testing.T) {
+	if _, _, err := Find(t.TempDir()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, tc := range []struct{ name, contents, want string }{
+		{"empty", "", "does not pin anything"},
+		{"only comments", "# account: bob@example.com\n", "does not pin anything"},
+		{"unknown keys", "owner: payments\n", "does not pin anything"},
+		{"syntax", "account: [bob\n", "failed to parse"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := writePin(t, t.TempDir(), tc.contents)
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestMismatches(t *testing.T) {
+	pinned := types.Pin{Account: "bob@example.com", Project: "beta-456", Region: "europe-west1"}
+	active := types.Pin{Account: "bob@example.com", Project: "alpha-123", Configuration: "default"}
+
+	want := []string{"project: pinned beta-456, active alpha-123", "region: pinned europe-west1, active (unset)"}
+	if got := Mismatches(pinned, active); !slices.Equal(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := Mismatches(pinned, pinned); len(got) > 0 {
+		t.Errorf("Expected no mismatch, got %q", got)
+	}
+}
@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/ui"
+)
+
+func TestUpdateProfiles(t *testing.T) {
+	profile := userconfig.Profile{
+		Name:        "client",
+		Account:     "bob@example.com",
+		Project:     "beta-456",
+		Region:      "europe-west1",
+		Impersonate: "deployer@beta-456.iam.gserviceaccount.com",
+	}
+	// scriptProfile scripts the account check run before the profile is applied
+	scriptProfile := func(runner *gcp.FakeRunner) {
+		runner.Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)")
+	}
+
+	m, runner := newTestModel(t)
+	if m := InitialModel(ui.NewStyles(), runner, userconfig.Config{Profiles: []userconfig.Profile{profile}}); m.UI.MainMenuChoice != MenuProfiles {
+		t.Errorf("Expected the profile picker to be the default menu entry, got %d", m.UI.MainMenuChoice)
+	}
+
+	m.Settings.Profiles = []userconfig.Profile{profile}
+	scriptProfile(runner)
+	runner.
+		Respond("", "config", "set", "account", "bob@example.com").
+		Respond("", "config", "set", "project", "beta-456").
+		Respond("", "config", "set", "compute/region", "europe-west1").
+		Respond("", "config", "set", "auth/impersonate_service_account", profile.Impersonate).
+		Respond("bob@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("beta-456\n", "config", "get-value", "project").
+		Respond(profile.Impersonate+"\n", "config", "get-value", "auth/impersonate_service_account")
+
+	m = pressKey(m, "f")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Switch to profile client") {
+		t.Fatalf("Expected a confirmation for the profile, got:\n%s", m.View())
+	}
+	m = pressKey(m, "enter")
+
+	if m.StateMachine.GetState() != StateMain {
+		t.Fatalf("Expected StateMain after applying the profile, got %v: %v", m.StateMachine.GetState(), m.UI.Err)
+	}
+	if m.Data.ActiveAccount != "bob@example.com" || m.Data.ActiveProject != "beta-456" || m.Data.Impersonating != profile.Impersonate {
+		t.Errorf("Expected the profile to be active, got %q on %q as %q", m.Data.ActiveAccount, m.Data.ActiveProject, m.Data.Impersonating)
+	}
+	if runner.Called("config", "unset", "compute/zone") {
+		t.Error("Expected properties that already match to be left alone")
+	}
+
+	// A failing step restores what was already changed, as written in the
+	// configuration file
+	m, runner = newTestModel(t)
+	writeGcloudConfig(t, "[core]\naccount = alice@example.com\nproject = alpha-123\n")
+	m.Settings.Profiles = []userconfig.Profile{profile}
+	scriptProfile(runner)
+	runner.
+		Respond("", "config", "set", "account", "bob@example.com").
+		Respond("", "config", "set", "project", "beta-456").
+		Fail(errors.New("exit status 1"), "ERROR: invalid region", "config", "set", "compute/region", "europe-west1").
+		Respond("", "config", "set", "account", "alice@example.com").
+		Respond("", "config", "set", "project", "alpha-123")
+
+	m = pressKey(m, "f")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+
+	if m.StateMachine.GetState() != StateError || !strings.Contains(m.UI.Err.Error(), "previous settings were restored") {
+		t.Fatalf("Expected the failure to be reported after a rollback, got %v: %v", m.StateMachine.GetState(), m.UI.Err)
+	}
+	calls := runner.Calls()
+	restored := slices.IndexFunc(calls, func(call []string) bool {
+		return slices.Equal(call, []string{"config", "set", "account", "alice@example.com"})
+	})
+	if restored < 0 || slices.IndexFunc(calls, func(call []string) bool { return slices.Equal(call, []string{"config", "set", "project", "alpha-123"}) }) > restored {
+		t.Errorf("Expected the project then the account to be restored, got calls %v", calls)
+	}
+	if runner.Called("config", "set", "auth/impersonate_service_account", profile.Impersonate) {
+		t.Error("Expected no step to run after the failure")
+	}
+}
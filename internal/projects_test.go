@@ -0,0 +1,312 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mathd/gcp-switcher/internal/history"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestUpdateSwitchProject(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("Updated property [core/project].", "config", "set", "project", "beta-456")
+
+	m = pressKey(m, "p")
+	if m.StateMachine.GetState() != StateProjects {
+		t.Fatalf("Expected StateProjects, got %v", m.StateMachine.GetState())
+	}
+
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming {
+		t.Fatalf("Expected StateConfirming, got %v", m.StateMachine.GetState())
+	}
+	if !strings.Contains(m.View(), "Switch to project beta-456?") {
+		t.Error("Expected confirmation view to name the selected project")
+	}
+
+	// The refresh after the switch reports the new project
+	runner.Respond("beta-456\n", "config", "get-value", "project")
+	m = pressKey(m, "enter")
+
+	if !runner.Called("config", "set", "project", "beta-456") {
+		t.Error("Expected gcloud config set project to be called")
+	}
+	if m.StateMachine.GetState() != StateMain {
+		t.Fatalf("Expected StateMain after switching, got %v", m.StateMachine.GetState())
+	}
+	if m.Data.ActiveProject != "beta-456" {
+		t.Errorf("Expected active project beta-456, got %q", m.Data.ActiveProject)
+	}
+}
+
+func TestUpdateLabelFilter(t *testing.T) {
+	m, _ := newTestModel(t)
+	m = send(m, types.ProjectListMsg{Projects: []types.Project{
+		{ProjectID: "pay-prod", Name: "Payments", ProjectNumber: "111", Labels: map[string]string{"env": "prod", "team": "payments"}},
+		{ProjectID: "pay-dev", Name: "Payments", Labels: map[string]string{"env": "dev", "team": "payments"}},
+		{ProjectID: "web-prod", Name: "Web", LifecycleState: "DELETE_REQUESTED", Labels: map[string]string{"env": "prod"}},
+	}})
+	m = pressKey(m, "p")
+
+	if !strings.Contains(m.View(), "Payments • #111 • env:prod team:payments") {
+		t.Errorf("Expected the project number and labels in the description:\n%s", m.View())
+	}
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"env:prod", []string{"pay-prod", "web-prod"}},
+		{"env:prod team:payments", []string{"pay-prod"}},
+		{"team:", []string{"pay-prod", "pay-dev"}},
+		{"pay env:dev", []string{"pay-dev"}},
+		{"env:pro", nil},
+	}
+	for _, tt := range tests {
+		m.Components.ProjectList.SetFilterText(tt.filter)
+		var got []string
+		for _, item := range m.Components.ProjectList.VisibleItems() {
+			got = append(got, item.(types.Item).ID())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Filter %q: expected %v, got %v", tt.filter, tt.want, got)
+		}
+	}
+}
+
+func TestUpdateFavorites(t *testing.T) {
+	m, _ := newTestModel(t)
+
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "s")
+
+	first := m.Components.ProjectList.Items()[0].(types.Item)
+	if first.ID() != "beta-456" || !strings.Contains(first.Title(), "★") {
+		t.Errorf("Expected the starred project first with a marker, got %q", first.Title())
+	}
+	saved, err := userconfig.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !saved.IsFavorite("beta-456") {
+		t.Errorf("Expected the favorite to be persisted, got %v", saved.Favorites)
+	}
+
+	m = pressKey(m, "q")
+	if !strings.Contains(m.View(), "1. ★ beta-456") {
+		t.Error("Expected the main view to list favorites with number keys")
+	}
+
+	m = pressKey(m, "1")
+	if m.StateMachine.GetState() != StateConfirming {
+		t.Fatalf("Expected StateConfirming, got %v", m.StateMachine.GetState())
+	}
+	if !strings.Contains(m.View(), "Switch to project beta-456?") {
+		t.Error("Expected the number key to offer switching to the favorite")
+	}
+}
+
+func TestUpdateFavoriteSaveFails(t *testing.T) {
+	m, _ := newTestModel(t)
+	file := filepath.Join(os.Getenv("GCP_SWITCHER_CONFIG_DIR"), "config.yaml")
+	if err := os.WriteFile(file, []byte("switch_mode: local\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	complete := m.Operations.CommandsComplete
+
+	m = pressKey(m, "p")
+	m = pressKey(m, "s")
+	if m.Operations.CommandsComplete != complete || len(m.Operations.CommandErrors) > 0 {
+		t.Errorf("Expected the startup counters untouched, got %d complete and errors %q", m.Operations.CommandsComplete, m.Operations.CommandErrors)
+	}
+	if !strings.Contains(m.View(), "failed to save favorites") {
+		t.Errorf("Expected the save error in the project list:\n%s", m.View())
+	}
+	m = pressKey(m, "q")
+	if !strings.Contains(m.View(), "failed to save favorites") {
+		t.Errorf("Expected the save error on the main screen:\n%s", m.View())
+	}
+
+	// A later successful save clears it
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	m = pressKey(m, "p")
+	m = pressKey(m, "s")
+	if strings.Contains(m.View(), "failed to save favorites") {
+		t.Errorf("Expected the save error cleared:\n%s", m.View())
+	}
+}
+
+func TestUpdateRecordsHistory(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("", "config", "set", "project", "beta-456")
+
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	runner.Respond("beta-456\n", "config", "get-value", "project")
+	m = pressKey(m, "enter")
+
+	saved, err := history.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Entries) != 1 || saved.Entries[0].Account != "alice@example.com" || saved.Entries[0].Project != "beta-456" {
+		t.Fatalf("Expected the switch to be recorded, got %+v", saved.Entries)
+	}
+
+	// Switching back puts the previous pair in the Recent section
+	runner.Respond("", "config", "set", "project", "alpha-123")
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	runner.Respond("alpha-123\n", "config", "get-value", "project")
+	m = pressKey(m, "enter")
+
+	if !strings.Contains(m.View(), "Recent") || !strings.Contains(m.View(), "beta-456") {
+		t.Error("Expected the main view to list the previous project under Recent")
+	}
+	first := m.Components.ProjectList.Items()[0].(types.Item)
+	if first.ID() != "alpha-123" {
+		t.Errorf("Expected the most recently used project first, got %s", first.ID())
+	}
+}
+
+func TestUpdateRecentShortcuts(t *testing.T) {
+	m, _ := newTestModel(t)
+	now := time.Now()
+	m.Data.History = history.History{Entries: []history.Entry{
+		{Time: now, Account: "alice@example.com", Project: "alpha-123"},
+		{Time: now.Add(-time.Minute), Account: "bob@example.com", Project: "beta-456"},
+		{Time: now.Add(-time.Hour), Account: "alice@example.com", Project: "beta-456"},
+		{Time: now.Add(-2 * time.Hour), Account: "carol@example.com"},
+	}}
+
+	view := m.View()
+	for _, want := range []string{"v. bob@example.com / beta-456", "w. alice@example.com / beta-456", "x. carol@example.com"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected %q under Recent:\n%s", want, view)
+		}
+	}
+
+	for _, tc := range []struct{ key, prompt string }{
+		{"v", "Switch to account bob@example.com and project beta-456?"},
+		{"w", "Switch to project beta-456?"},
+		{"x", "Switch to account carol@example.com?"},
+	} {
+		m = pressKey(m, tc.key)
+		if m.StateMachine.GetState() != StateConfirming || !strings.Contains(m.View(), tc.prompt) {
+			t.Errorf("Expected %s to ask %q, got %v:\n%s", tc.key, tc.prompt, m.StateMachine.GetState(), m.View())
+		}
+		m.StateMachine.Fire(TriggerConfirmNo)
+	}
+
+	// Keys without an entry do nothing
+	m = pressKey(m, "y")
+	if m.StateMachine.GetState() != StateMain {
+		t.Errorf("Expected StateMain, got %v", m.StateMachine.GetState())
+	}
+}
+
+func TestUpdateSearchAllProjects(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond(projectsJSON, "projects", "list", "--format=json", "--account=alice@example.com").
+		Respond(`[{"name":"Client","projectId":"client-789"}]`, "projects", "list", "--format=json", "--account=bob@example.com")
+
+	m = pressKey(m, "s")
+	if m.StateMachine.GetState() != StateAllProjects {
+		t.Fatalf("Expected StateAllProjects, got %v", m.StateMachine.GetState())
+	}
+	items := m.Components.AllProjectsList.Items()
+	if len(items) != 3 {
+		t.Fatalf("Expected the projects of both accounts, got %d items", len(items))
+	}
+	for i, item := range items {
+		if item.(types.Item).ID() == "client-789/bob@example.com" {
+			m.Components.AllProjectsList.Select(i)
+		}
+	}
+	if !strings.Contains(m.View(), "via bob@example.com") {
+		t.Error("Expected rows to be tagged with their account")
+	}
+
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "Switch to account bob@example.com and project client-789?") {
+		t.Fatalf("Expected a single confirmation for the account and project, got:\n%s", m.View())
+	}
+
+	runner.
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)").
+		Respond("", "config", "set", "account", "bob@example.com").
+		Respond("", "config", "set", "project", "client-789").
+		Respond("bob@example.com\n", "auth", "list", "--filter=status:ACTIVE", "--format=value(account)").
+		Respond("client-789\n", "config", "get-value", "project")
+	m = pressKey(m, "enter")
+
+	if m.Data.ActiveAccount != "bob@example.com" || m.Data.ActiveProject != "client-789" {
+		t.Errorf("Expected bob@example.com on client-789, got %q on %q", m.Data.ActiveAccount, m.Data.ActiveProject)
+	}
+	if project, _ := m.Data.History.LastProject("bob@example.com"); project != "client-789" {
+		t.Errorf("Expected the switch to be recorded for bob@example.com, got %q", project)
+	}
+
+	// Searching again is served from the per-account cache
+	m = pressKey(m, "s")
+	if m.StateMachine.GetState() != StateAllProjects {
+		t.Fatalf("Expected StateAllProjects, got %v", m.StateMachine.GetState())
+	}
+	searches := 0
+	for _, call := range runner.Calls() {
+		if slices.Contains(call, "--account=bob@example.com") {
+			searches++
+		}
+	}
+	if searches != 1 {
+		t.Errorf("Expected the cached projects of bob@example.com to be reused, got %d searches", searches)
+	}
+}
+
+func TestUpdateSwitchAccountProjectRollsBack(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond(projectsJSON, "projects", "list", "--format=json", "--account=alice@example.com").
+		Respond(`[{"name":"Client","projectId":"client-789"}]`, "projects", "list", "--format=json", "--account=bob@example.com").
+		Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)").
+		Respond("", "config", "set", "account", "bob@example.com").
+		Fail(errors.New("exit status 1"), "ERROR: (gcloud.config.set) permission denied", "config", "set", "project", "client-789").
+		Respond("", "config", "set", "account", "alice@example.com")
+	writeGcloudConfig(t, "[core]\naccount = alice@example.com\nproject = alpha-123\n")
+
+	m = pressKey(m, "s")
+	for i, item := range m.Components.AllProjectsList.Items() {
+		if item.(types.Item).ID() == "client-789/bob@example.com" {
+			m.Components.AllProjectsList.Select(i)
+		}
+	}
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+
+	if m.StateMachine.GetState() != StateError {
+		t.Fatalf("Expected the failed project step to be reported, got %v", m.StateMachine.GetState())
+	}
+	if !runner.Called("config", "set", "account", "alice@example.com") {
+		t.Error("Expected the previous account to be restored")
+	}
+	if view := m.View(); !strings.Contains(view, "permission denied") || !strings.Contains(view, "previous settings were restored") {
+		t.Errorf("Expected the project error and the rollback in the view:\n%s", view)
+	}
+	if m.Data.ActiveAccount != "alice@example.com" {
+		t.Errorf("Expected alice@example.com to stay active, got %q", m.Data.ActiveAccount)
+	}
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/types"
+)
+
+func TestUpdateHierarchy(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond(`[{"name":"organizations/1","displayName":"example.com"}]`, "organizations", "list", "--format=json").
+		Respond(`[{"name":"folders/10","displayName":"Payments","parent":"organizations/1"}]`,
+			"resource-manager", "folders", "list", "--organization=1", "--format=json").
+		Respond(`[]`, "resource-manager", "folders", "list", "--folder=10", "--format=json").
+		Respond("", "config", "set", "project", "beta-456")
+	m = send(m, types.ProjectListMsg{Projects: []types.Project{
+		{ProjectID: "alpha-123", Name: "Alpha", Parent: &types.ResourceParent{Type: "organization", ID: "1"}},
+		{ProjectID: "beta-456", Name: "Beta", Parent: &types.ResourceParent{Type: "folder", ID: "10"}},
+	}})
+
+	m = pressKey(m, "o")
+	if m.StateMachine.GetState() != StateHierarchy {
+		t.Fatalf("Expected StateHierarchy once the tree is loaded, got %v", m.StateMachine.GetState())
+	}
+	view := m.View()
+	if !strings.Contains(view, "example.com") || !strings.Contains(view, "Payments") || strings.Contains(view, "beta-456") {
+		t.Fatalf("Expected the organization expanded and the folder collapsed:\n%s", view)
+	}
+
+	// Focusing the folder lists everything beneath it
+	m.selectHierarchyItem("folders/10")
+	m = pressKey(m, "f")
+	if items := m.Components.HierarchyList.Items(); len(items) != 1 || items[0].(types.Item).ID() != "beta-456" {
+		t.Fatalf("Expected only the projects under Payments, got %v", items)
+	}
+
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming {
+		t.Fatalf("Expected StateConfirming after selecting a project, got %v", m.StateMachine.GetState())
+	}
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "set", "project", "beta-456") {
+		t.Error("Expected the project selected in the tree to be switched to")
+	}
+}
+
+func TestUpdateFolderProtection(t *testing.T) {
+	runner := newFakeRunner(t).
+		Respond(`[{"name":"organizations/1","displayName":"example.com"}]`, "organizations", "list", "--format=json").
+		Respond(`[{"name":"folders/10","displayName":"Payments","parent":"organizations/1"}]`,
+			"resource-manager", "folders", "list", "--organization=1", "--format=json").
+		Respond(`[{"name":"folders/20","displayName":"Prod","parent":"folders/10"}]`,
+			"resource-manager", "folders", "list", "--folder=10", "--format=json").
+		Respond(`[]`, "resource-manager", "folders", "list", "--folder=20", "--format=json")
+	t.Setenv("CLOUDSDK_CONFIG", "gcloudconfig/testdata/sdk")
+	projects := types.ProjectListMsg{Projects: []types.Project{
+		{ProjectID: "alpha-123", Name: "Alpha", Parent: &types.ResourceParent{Type: "folder", ID: "20"}},
+		{ProjectID: "beta-456", Name: "Beta", Parent: &types.ResourceParent{Type: "organization", ID: "1"}},
+	}}
+	rules := []userconfig.ProtectionRule{{Folder: "10"}}
+
+	m := loadedModel(t, runner)
+	m.Settings.Protected = rules
+	m = send(m, projects)
+	if runner.Called("organizations", "list", "--format=json") {
+		t.Fatal("Expected the tree not to be listed before a protection check")
+	}
+
+	// Until the tree is known, switching requires the project ID
+	m = pressKey(m, "p")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "PROTECTED PROJECT (folders not loaded yet)") {
+		t.Fatalf("Expected typed confirmation while the folders are unknown:\n%s", m.View())
+	}
+	m = pressKey(m, "esc")
+
+	// Checking the active project fetches the tree once
+	m = send(m, types.ActiveProjectMsg{Project: "beta-456"})
+	if !runner.Called("resource-manager", "folders", "list", "--folder=20", "--format=json") {
+		t.Fatal("Expected the folders to be listed for the protection check")
+	}
+	if rule, ok := m.protectionRule("alpha-123"); !ok || rule.Folder != "10" {
+		t.Errorf("Expected alpha-123 to be protected by its parent folder, got %v", rule)
+	}
+	if _, ok := m.protectionRule("beta-456"); ok {
+		t.Error("Expected beta-456 outside the folder to be unprotected")
+	}
+
+	// The next run reads the tree from the cache
+	listed := len(runner.Calls())
+	m = loadedModel(t, runner)
+	m.Settings.Protected = rules
+	m = send(m, projects)
+	m = send(m, types.ActiveProjectMsg{Project: "beta-456"})
+	for _, call := range runner.Calls()[listed:] {
+		if call[0] == "organizations" || call[0] == "resource-manager" {
+			t.Errorf("Expected the cached tree to be reused, got gcloud %v", call)
+		}
+	}
+	if _, ok := m.protectionRule("alpha-123"); !ok {
+		t.Error("Expected alpha-123 to be protected from the cached tree")
+	}
+}
+
+func TestUpdateProtectedProject(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("", "config", "set", "project", "beta-456")
+	m.Settings.Protected = []userconfig.ProtectionRule{{Label: "env=prod"}}
+	m = send(m, types.ProjectListMsg{Projects: []types.Project{
+		{ProjectID: "alpha-123", Name: "Alpha", Labels: map[string]string{"env": "dev"}},
+		{ProjectID: "beta-456", Name: "Beta", Labels: map[string]string{"env": "prod"}},
+	}})
+	if strings.Contains(m.View(), "PROTECTED") {
+		t.Fatal("Expected no warning while an unprotected project is active")
+	}
+
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	if !strings.Contains(m.View(), "PROTECTED PROJECT (label env=prod)") {
+		t.Fatalf("Expected the protection warning in the confirmation:\n%s", m.View())
+	}
+
+	// Neither Enter nor a wrong ID confirms the switch
+	m = pressKey(m, "enter")
+	m = pressKey(m, "beta-45")
+	m = pressKey(m, "enter")
+	if m.StateMachine.GetState() != StateConfirming || runner.Called("config", "set", "project", "beta-456") {
+		t.Fatal("Expected the switch to wait for the exact project ID")
+	}
+	if !strings.Contains(m.View(), "does not match") {
+		t.Error("Expected the mismatch to be reported")
+	}
+
+	runner.Respond("beta-456\n", "config", "get-value", "project").
+		Respond(`[{"projectId":"beta-456","name":"Beta","labels":{"env":"prod"}}]`, "projects", "list", "--format=json")
+	m = pressKey(m, "6")
+	m = pressKey(m, "enter")
+	if !runner.Called("config", "set", "project", "beta-456") {
+		t.Fatal("Expected the switch once the project ID is typed")
+	}
+	if !strings.Contains(m.View(), "PROTECTED PROJECT") {
+		t.Error("Expected the main screen to warn while the protected project is active")
+	}
+}
@@ -0,0 +1,35 @@
+package shell
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//go:embed scripts/init.*
+var scripts embed.FS
+
+// Init renders the integration script for a shell: a gcps wrapper function
+// around export mode, a Ctrl-G key binding and tab completion. binary is the
+// path used to invoke gcp-switcher from the script.
+func Init(sh Shell, binary string) (string, error) {
+	var name string
+	switch sh {
+	case Bash, Zsh, Fish:
+		name = "scripts/init." + string(sh)
+	default:
+		return "", fmt.Errorf("shell integration is not available for %s (want bash, zsh or fish)", sh)
+	}
+
+	tmpl, err := template.ParseFS(scripts, name)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, struct{ Binary string }{quotePOSIX(binary)}); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
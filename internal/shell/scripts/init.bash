@@ -0,0 +1,45 @@
+# gcp-switcher shell integration for bash
+# Add to ~/.bashrc:  eval "$({{.Binary}} shell-init bash)"
+
+# gcps opens the picker and applies the result to this shell only.
+# With arguments it runs a gcp-switcher subcommand instead; subcommands that
+# switch also apply to this shell only.
+gcps() {
+  local exports
+  case "$1" in
+    account|project|apply|-) ;;
+    ?*)
+      {{.Binary}} "$@"
+      return
+      ;;
+  esac
+  exports="$({{.Binary}} --export --shell bash "$@")" || return
+  eval "$exports"
+}
+
+# Ctrl-G opens the picker
+bind -x '"\C-g": gcps' 2>/dev/null
+
+_gcps_complete() {
+  local cur="${COMP_WORDS[COMP_CWORD]}"
+  local candidates=""
+  case "$COMP_CWORD" in
+    1) candidates="current accounts projects account project apply - shell-init help" ;;
+    2)
+      case "${COMP_WORDS[1]}" in
+        accounts|projects) candidates="list" ;;
+        account|project) candidates="set" ;;
+        apply) candidates="--check" ;;
+        shell-init) candidates="bash zsh fish" ;;
+      esac
+      ;;
+    3)
+      case "${COMP_WORDS[1]} ${COMP_WORDS[2]}" in
+        "project set") candidates="$({{.Binary}} complete projects 2>/dev/null | cut -f1)" ;;
+        "account set") candidates="$({{.Binary}} complete accounts 2>/dev/null | cut -f1)" ;;
+      esac
+      ;;
+  esac
+  COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+}
+complete -F _gcps_complete gcps gcp-switcher
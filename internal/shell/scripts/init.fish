@@ -0,0 +1,28 @@
+# gcp-switcher shell integration for fish
+# Add to ~/.config/fish/config.fish:  {{.Binary}} shell-init fish | source
+
+# gcps opens the picker and applies the result to this shell only.
+# With arguments it runs a gcp-switcher subcommand instead; subcommands that
+# switch also apply to this shell only.
+function gcps
+    if test (count $argv) -gt 0; and not contains -- $argv[1] account project apply -
+        {{.Binary}} $argv
+        return
+    end
+    set -l exports ({{.Binary}} --export --shell fish $argv); or return
+    string join \n -- $exports | source
+end
+
+# Ctrl-G opens the picker
+bind \cg 'gcps; commandline -f repaint'
+
+for cmd in gcps gcp-switcher
+    complete -c $cmd -f
+    complete -c $cmd -n __fish_use_subcommand -a 'current accounts projects account project apply - shell-init help'
+    complete -c $cmd -n '__fish_seen_subcommand_from accounts projects' -a list
+    complete -c $cmd -n '__fish_seen_subcommand_from apply' -a --check
+    complete -c $cmd -n '__fish_seen_subcommand_from account project; and not __fish_seen_subcommand_from set' -a set
+    complete -c $cmd -n '__fish_seen_subcommand_from shell-init' -a 'bash zsh fish'
+    complete -c $cmd -n '__fish_seen_subcommand_from project; and __fish_seen_subcommand_from set' -a '({{.Binary}} complete projects 2>/dev/null)'
+    complete -c $cmd -n '__fish_seen_subcommand_from account; and __fish_seen_subcommand_from set' -a '({{.Binary}} complete accounts 2>/dev/null)'
+end
@@ -0,0 +1,79 @@
+// Package shell renders snippets for the shells gcp-switcher integrates with.
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Shell identifies a supported shell dialect
+type Shell string
+
+const (
+	Bash       Shell = "bash"
+	Zsh        Shell = "zsh"
+	Fish       Shell = "fish"
+	PowerShell Shell = "powershell"
+)
+
+// Parse validates a shell name
+func Parse(name string) (Shell, error) {
+	switch sh := Shell(strings.ToLower(name)); sh {
+	case Bash, Zsh, Fish, PowerShell:
+		return sh, nil
+	case "pwsh":
+		return PowerShell, nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (want bash, zsh, fish or powershell)", name)
+}
+
+// Detect guesses the user's shell from $SHELL, defaulting to bash
+func Detect() Shell {
+	if sh, err := Parse(filepath.Base(os.Getenv("SHELL"))); err == nil {
+		return sh
+	}
+	return Bash
+}
+
+// Export renders statements that set the given environment variables.
+// Variables are emitted in name order so the output is stable.
+func Export(sh Shell, vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		value := vars[name]
+		switch sh {
+		case Fish:
+			fmt.Fprintf(&b, "set -gx %s %s;\n", name, quoteFish(value))
+		case PowerShell:
+			fmt.Fprintf(&b, "$Env:%s = %s\n", name, quotePowerShell(value))
+		default:
+			fmt.Fprintf(&b, "export %s=%s\n", name, quotePOSIX(value))
+		}
+	}
+	return b.String()
+}
+
+// quotePOSIX single-quotes a value for bash and zsh
+func quotePOSIX(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// quoteFish single-quotes a value for fish
+func quoteFish(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// quotePowerShell single-quotes a value for PowerShell
+func quotePowerShell(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,34 @@
+package shell
+
+import "testing"
+
+func TestExport(t *testing.T) {
+	vars := map[string]string{
+		"CLOUDSDK_CORE_PROJECT": "it's-prod",
+		"CLOUDSDK_CORE_ACCOUNT": "alice@example.com",
+	}
+
+	tests := []struct {
+		shell Shell
+		want  string
+	}{
+		{Bash, "export CLOUDSDK_CORE_ACCOUNT='alice@example.com'\nexport CLOUDSDK_CORE_PROJECT='it'\\''s-prod'\n"},
+		{Fish, "set -gx CLOUDSDK_CORE_ACCOUNT 'alice@example.com';\nset -gx CLOUDSDK_CORE_PROJECT 'it\\'s-prod';\n"},
+		{PowerShell, "$Env:CLOUDSDK_CORE_ACCOUNT = 'alice@example.com'\n$Env:CLOUDSDK_CORE_PROJECT = 'it''s-prod'\n"},
+	}
+
+	for _, tt := range tests {
+		if got := Export(tt.shell, vars); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.shell, tt.want, got)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if sh, err := Parse("pwsh"); err != nil || sh != PowerShell {
+		t.Errorf("Expected pwsh to parse as PowerShell, got %q, %v", sh, err)
+	}
+	if _, err := Parse("tcsh"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
@@ -2,7 +2,6 @@ package internal
 
 import (
 	"context"
-	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/mathd/gcp-switcher/cmd/gcp"
@@ -21,6 +20,18 @@ const (
 	StateManualProject
 	StateConfirming
 	StateProcessing
+	StateConfigurations
+	StateConfigurationName
+	StateHierarchy
+	StateRegions
+	StateZones
+	StateADC
+	StateQuotaProject
+	StateCredentials
+	StateKeyFile
+	StateCleanup
+	StateAllProjects
+	StateProfiles
 )
 
 // AppTrigger represents the state transition triggers
@@ -40,17 +51,123 @@ const (
 	TriggerOperationComplete
 	TriggerOperationFailed
 	TriggerGoBack
+	TriggerLoadConfigurations
+	TriggerConfigurationSelected
+	TriggerEditConfigurationName
+	TriggerConfigurationNamed
+	TriggerFavoriteSelected
+	TriggerLoadHierarchy
+	TriggerLoadLocations
+	TriggerRegionSelected
+	TriggerLocationSelected
+	TriggerADCAction
+	TriggerEditQuotaProject
+	TriggerQuotaProjectEntered
+	TriggerLoadCredentials
+	TriggerCredentialAction
+	TriggerEditKeyFile
+	TriggerKeyFileEntered
+	TriggerRevokeAccount
+	TriggerCleanup
+	TriggerRestoreProject
+	TriggerLoadAllProjects
+	TriggerProfileSelected
+	TriggerRecentSelected
 )
 
+// Main menu entries, in display order
+const (
+	MenuAccounts = iota
+	MenuProjects
+	MenuLogin
+	MenuManualProject
+	MenuConfigurations
+	MenuHierarchy
+	MenuLocation
+	MenuADC
+	MenuCredentials
+	MenuAllProjects
+	MenuProfiles
+)
+
+// ActionKind identifies the operation run when a confirmation is accepted
+type ActionKind int
+
+const (
+	ActionNone ActionKind = iota
+	ActionLogin
+	ActionSwitchAccount
+	ActionSwitchProject
+	ActionActivateConfiguration
+	ActionCreateConfiguration
+	ActionRenameConfiguration
+	ActionDeleteConfiguration
+	ActionSetLocation
+	ActionADCLogin
+	ActionRevokeADC
+	ActionSetQuotaProject
+	// ActionImpersonate impersonates the target service account, or stops
+	// impersonating when the target is empty
+	ActionImpersonate
+	// ActionActivateServiceAccount adds the target key file
+	ActionActivateServiceAccount
+	ActionRevokeCredential
+	// ActionRevokeAccounts revokes the credentials of every account in Targets
+	ActionRevokeAccounts
+	// ActionSwitchAccountProject switches to Options.Account and the target
+	// project together
+	ActionSwitchAccountProject
+	// ActionApplyProfile switches to every setting of Options.Profile at
+	// once; the target is the profile's project
+	ActionApplyProfile
+)
+
+// ConfirmPolicy tells how a pending action is confirmed
+type ConfirmPolicy int
+
+const (
+	// ConfirmYesNo asks a plain Yes/No question
+	ConfirmYesNo ConfirmPolicy = iota
+	// ConfirmTyped requires the target to be typed exactly, e.g. for protected projects
+	ConfirmTyped
+)
+
+// ActionOptions holds the arguments some actions take besides their target
+type ActionOptions struct {
+	NewName string           // New name of a renamed configuration
+	Region  string           // Region remembered for the target project, set along with it
+	Zone    string           // Zone set along with the target region or Region; empty clears it
+	Login   gcp.LoginOptions // How logins reach a browser and whether ADC follows
+	Account string           // Account switched to along with the target project
+	Profile gcp.Context      // Settings applied by a profile
+}
+
+// PendingAction is an operation awaiting confirmation. It is passed along
+// with the trigger entering StateConfirming and run on entering StateProcessing.
+type PendingAction struct {
+	Kind    ActionKind
+	Target  string   // Account, project, configuration, region, key file or service account acted on
+	Targets []string // Accounts a bulk action applies to
+	Options ActionOptions
+	Confirm ConfirmPolicy
+	Prompt  string // Question asked in StateConfirming
+}
+
 // StateMachineContext holds data for state transitions
 type StateMachineContext struct {
 	LoadingContext LoadingContext
-	SelectedID     string
 	MenuChoice     int
 	HasAccounts    bool
 	HasProjects    bool
-	ConfirmText    string
+	HasConfigs     bool
+	HasHierarchy   bool
+	HasLocations   bool
+	HasCredentials bool
+	HasAllProjects bool
+	Pending        PendingAction
+	ConfirmTyped   string // Text typed to confirm a ConfirmTyped action
 	Error          error
+	ExportMode     bool
 }
 
 // AppStateMachine wraps the stateless state machine
@@ -80,55 +197,168 @@ func NewAppStateMachine() *AppStateMachine {
 
 	// Configure Main State
 	machine.Configure(StateMain).
+		OnEntry(func(_ context.Context, args ...any) error {
+			// Pending actions never outlive a return to the main menu
+			ctx.Pending = PendingAction{}
+			ctx.ConfirmTyped = ""
+			return nil
+		}).
 		Permit(TriggerLoadAccounts, StateLoading, func(_ context.Context, args ...any) bool {
 			return !ctx.HasAccounts
 		}).
 		Permit(TriggerMenuChoice, StateAccounts, func(_ context.Context, args ...any) bool {
-			return ctx.MenuChoice == 0 && ctx.HasAccounts
+			return ctx.MenuChoice == MenuAccounts && ctx.HasAccounts
 		}).
 		Permit(TriggerLoadProjects, StateLoading, func(_ context.Context, args ...any) bool {
 			return !ctx.HasProjects
 		}).
 		Permit(TriggerMenuChoice, StateProjects, func(_ context.Context, args ...any) bool {
-			return ctx.MenuChoice == 1 && ctx.HasProjects
+			return ctx.MenuChoice == MenuProjects && ctx.HasProjects
 		}).
 		Permit(TriggerMenuChoice, StateConfirming, func(_ context.Context, args ...any) bool {
-			return ctx.MenuChoice == 2 // New Login
+			return ctx.MenuChoice == MenuLogin
 		}).
 		Permit(TriggerMenuChoice, StateManualProject, func(_ context.Context, args ...any) bool {
-			return ctx.MenuChoice == 3 // Manual Project
-		})
+			return ctx.MenuChoice == MenuManualProject
+		}).
+		Permit(TriggerLoadConfigurations, StateLoading, func(_ context.Context, args ...any) bool {
+			return !ctx.HasConfigs
+		}).
+		Permit(TriggerMenuChoice, StateConfigurations, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuConfigurations && ctx.HasConfigs
+		}).
+		Permit(TriggerLoadHierarchy, StateLoading, func(_ context.Context, args ...any) bool {
+			return !ctx.HasHierarchy
+		}).
+		Permit(TriggerMenuChoice, StateHierarchy, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuHierarchy && ctx.HasHierarchy
+		}).
+		Permit(TriggerLoadLocations, StateLoading, func(_ context.Context, args ...any) bool {
+			return !ctx.HasLocations
+		}).
+		Permit(TriggerMenuChoice, StateRegions, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuLocation && ctx.HasLocations
+		}).
+		Permit(TriggerMenuChoice, StateADC, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuADC
+		}).
+		Permit(TriggerLoadCredentials, StateLoading, func(_ context.Context, args ...any) bool {
+			return !ctx.HasCredentials
+		}).
+		Permit(TriggerMenuChoice, StateCredentials, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuCredentials && ctx.HasCredentials
+		}).
+		Permit(TriggerLoadAllProjects, StateLoading, func(_ context.Context, args ...any) bool {
+			return !ctx.HasAllProjects
+		}).
+		Permit(TriggerMenuChoice, StateAllProjects, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuAllProjects && ctx.HasAllProjects
+		}).
+		Permit(TriggerMenuChoice, StateProfiles, func(_ context.Context, args ...any) bool {
+			return ctx.MenuChoice == MenuProfiles
+		}).
+		Permit(TriggerFavoriteSelected, StateConfirming).
+		Permit(TriggerRecentSelected, StateConfirming)
 
 	// Configure Accounts State
 	machine.Configure(StateAccounts).
 		Permit(TriggerAccountSelected, StateConfirming).
+		Permit(TriggerRevokeAccount, StateConfirming).
+		Permit(TriggerCleanup, StateCleanup).
 		Permit(TriggerGoBack, StateMain)
 
+	// Configure Cleanup State
+	machine.Configure(StateCleanup).
+		Permit(TriggerRevokeAccount, StateConfirming).
+		Permit(TriggerGoBack, StateAccounts)
+
 	// Configure Projects State
 	machine.Configure(StateProjects).
 		Permit(TriggerProjectSelected, StateConfirming).
 		Permit(TriggerGoBack, StateMain)
 
+	// Configure Hierarchy State
+	machine.Configure(StateHierarchy).
+		Permit(TriggerProjectSelected, StateConfirming).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure All Projects State
+	machine.Configure(StateAllProjects).
+		Permit(TriggerProjectSelected, StateConfirming).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure Profiles State
+	machine.Configure(StateProfiles).
+		Permit(TriggerProfileSelected, StateConfirming).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure Regions State
+	machine.Configure(StateRegions).
+		Permit(TriggerRegionSelected, StateZones).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure Zones State
+	machine.Configure(StateZones).
+		Permit(TriggerLocationSelected, StateConfirming).
+		Permit(TriggerGoBack, StateRegions)
+
+	// Configure ADC State
+	machine.Configure(StateADC).
+		Permit(TriggerADCAction, StateConfirming).
+		Permit(TriggerEditQuotaProject, StateQuotaProject).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure Quota Project State
+	machine.Configure(StateQuotaProject).
+		Permit(TriggerQuotaProjectEntered, StateConfirming).
+		Permit(TriggerGoBack, StateADC)
+
+	// Configure Credentials State
+	machine.Configure(StateCredentials).
+		Permit(TriggerCredentialAction, StateConfirming).
+		Permit(TriggerEditKeyFile, StateKeyFile).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure Key File State
+	machine.Configure(StateKeyFile).
+		Permit(TriggerKeyFileEntered, StateConfirming).
+		Permit(TriggerGoBack, StateCredentials)
+
 	// Configure Manual Project State
 	machine.Configure(StateManualProject).
 		Permit(TriggerManualProjectEntry, StateConfirming).
 		Permit(TriggerGoBack, StateMain)
 
+	// Configure Configurations State
+	machine.Configure(StateConfigurations).
+		Permit(TriggerConfigurationSelected, StateConfirming).
+		Permit(TriggerEditConfigurationName, StateConfigurationName).
+		Permit(TriggerGoBack, StateMain)
+
+	// Configure Configuration Name State
+	machine.Configure(StateConfigurationName).
+		Permit(TriggerConfigurationNamed, StateConfirming).
+		Permit(TriggerGoBack, StateConfigurations)
+
 	// Configure Confirming State
 	machine.Configure(StateConfirming).
 		OnEntry(func(_ context.Context, args ...any) error {
 			if len(args) > 0 {
-				if text, ok := args[0].(string); ok {
-					ctx.ConfirmText = text
+				if action, ok := args[0].(PendingAction); ok {
+					ctx.Pending = action
+					ctx.ConfirmTyped = ""
 				}
 			}
 			return nil
 		}).
-		Permit(TriggerConfirmYes, StateProcessing).
+		Permit(TriggerConfirmYes, StateProcessing, func(_ context.Context, args ...any) bool {
+			return ctx.Pending.Confirm != ConfirmTyped || ctx.ConfirmTyped == ctx.Pending.Target
+		}).
 		Permit(TriggerConfirmNo, StateMain)
 
 	// Configure Processing State
 	machine.Configure(StateProcessing).
+		Permit(TriggerRestoreProject, StateConfirming).
 		Permit(TriggerOperationComplete, StateMain).
 		Permit(TriggerOperationFailed, StateError)
 
@@ -186,55 +416,149 @@ func (sm *AppStateMachine) SetHasProjects(hasProjects bool) {
 	sm.context.HasProjects = hasProjects
 }
 
-// SetSelectedID sets the selected item ID
-func (sm *AppStateMachine) SetSelectedID(id string) {
-	sm.context.SelectedID = id
+// SetHasConfigurations sets whether configurations are available
+func (sm *AppStateMachine) SetHasConfigurations(hasConfigs bool) {
+	sm.context.HasConfigs = hasConfigs
+}
+
+// SetHasHierarchy sets whether the organization tree has been loaded
+func (sm *AppStateMachine) SetHasHierarchy(hasHierarchy bool) {
+	sm.context.HasHierarchy = hasHierarchy
+}
+
+// SetHasLocations sets whether the regions and zones have been loaded
+func (sm *AppStateMachine) SetHasLocations(hasLocations bool) {
+	sm.context.HasLocations = hasLocations
+}
+
+// SetHasCredentials sets whether the credential inventory has been loaded
+func (sm *AppStateMachine) SetHasCredentials(hasCredentials bool) {
+	sm.context.HasCredentials = hasCredentials
+}
+
+// SetConfirmTyped records the text typed to confirm the pending action
+func (sm *AppStateMachine) SetConfirmTyped(typed string) {
+	sm.context.ConfirmTyped = typed
+}
+
+// SetHasAllProjects sets whether the projects of every account have been searched
+func (sm *AppStateMachine) SetHasAllProjects(hasAllProjects bool) {
+	sm.context.HasAllProjects = hasAllProjects
+}
+
+// SetExportMode selects whether switches are exported to the calling shell
+// instead of being written to gcloud's global configuration
+func (sm *AppStateMachine) SetExportMode(exportMode bool) {
+	sm.context.ExportMode = exportMode
 }
 
 // GetLoadCommand returns the appropriate loading command based on context
-func (sm *AppStateMachine) GetLoadCommand() tea.Cmd {
+func (sm *AppStateMachine) GetLoadCommand(r gcp.Runner) tea.Cmd {
 	switch sm.context.LoadingContext {
 	case LoadingAccounts:
-		return gcp.GetAllAccounts()
+		return gcp.GetAllAccounts(r)
 	case LoadingProjects:
-		return gcp.GetSimpleProjects()
+		return gcp.GetSimpleProjects(r)
+	case LoadingConfigurations:
+		return gcp.GetConfigurations(r)
+	case LoadingHierarchy:
+		return loadHierarchy(r)
+	case LoadingLocations:
+		return loadLocations(r)
+	case LoadingCredentials:
+		return gcp.GetCredentials(r)
 	default:
 		return tea.Batch(
-			gcp.CheckGcloud,
-			gcp.GetActiveAccount(),
-			gcp.GetActiveProject(),
-			gcp.GetAllAccounts(),
-			gcp.GetSimpleProjects(),
+			gcp.CheckGcloud(r),
+			gcp.GetActiveAccount(r),
+			gcp.GetActiveProject(r),
+			gcp.GetAllAccounts(r),
+			gcp.GetSimpleProjects(r),
+			gcp.GetConfigurations(r),
 		)
 	}
 }
 
-// GetActionCommand returns the appropriate action command based on context
-func (sm *AppStateMachine) GetActionCommand() tea.Cmd {
-	// Determine action based on previous state that led to confirmation
-	state := sm.machine.MustState().(AppState)
+// GetActionCommand returns the command running the pending action once it
+// has been confirmed
+func (sm *AppStateMachine) GetActionCommand(r gcp.Runner) tea.Cmd {
+	if sm.machine.MustState().(AppState) != StateProcessing {
+		return nil
+	}
 
-	// Check what triggered the current processing state
-	if state == StateProcessing {
-		// For login action
-		if sm.context.SelectedID == "" {
-			return gcp.LoginNewAccount()
+	action := sm.context.Pending
+	exportMode := sm.context.ExportMode
+	switch action.Kind {
+	case ActionLogin:
+		return gcp.LoginNewAccount(r, action.Options.Login)
+	case ActionSwitchAccount:
+		if exportMode {
+			return gcp.ExportAccount(r, action.Target)
 		}
-
-		// For account switch (we know this if SelectedID looks like an email)
-		if len(sm.context.SelectedID) > 0 && strings.Contains(sm.context.SelectedID, "@") {
-			return gcp.SwitchAccount(sm.context.SelectedID)
+		return gcp.SwitchAccount(r, action.Target)
+	case ActionSwitchProject:
+		if exportMode {
+			return gcp.ExportProject(action.Target)
 		}
-
-		// Otherwise it's a project switch
-		return gcp.SwitchProject(sm.context.SelectedID)
+		if action.Options.Region != "" {
+			return gcp.SwitchProjectLocation(r, action.Target, action.Options.Region, action.Options.Zone)
+		}
+		return gcp.SwitchProject(r, action.Target)
+	case ActionActivateConfiguration:
+		if exportMode {
+			return gcp.ExportConfiguration(action.Target)
+		}
+		return gcp.ActivateConfiguration(r, action.Target)
+	case ActionCreateConfiguration:
+		return gcp.CreateConfiguration(r, action.Target)
+	case ActionRenameConfiguration:
+		return gcp.RenameConfiguration(r, action.Target, action.Options.NewName)
+	case ActionDeleteConfiguration:
+		return gcp.DeleteConfiguration(r, action.Target)
+	case ActionSetLocation:
+		if exportMode {
+			return gcp.ExportLocation(action.Target, action.Options.Zone)
+		}
+		return gcp.SetLocation(r, action.Target, action.Options.Zone)
+	case ActionADCLogin:
+		return gcp.ADCLogin(r, action.Options.Login.Flags...)
+	case ActionRevokeADC:
+		return gcp.RevokeADC(r)
+	case ActionSetQuotaProject:
+		return gcp.SetQuotaProject(r, action.Target)
+	case ActionImpersonate:
+		if exportMode {
+			return gcp.ExportImpersonation(action.Target)
+		}
+		return gcp.SetImpersonation(r, action.Target)
+	case ActionActivateServiceAccount:
+		return gcp.ActivateServiceAccount(r, action.Target)
+	case ActionRevokeCredential:
+		return gcp.RevokeCredentials(r, action.Target)
+	case ActionRevokeAccounts:
+		return gcp.RevokeCredentials(r, action.Targets...)
+	case ActionSwitchAccountProject:
+		if exportMode {
+			return gcp.ExportAccountProject(r, action.Options.Account, action.Target)
+		}
+		return gcp.SwitchAccountProject(r, gcp.Context{
+			Account: action.Options.Account,
+			Project: action.Target,
+			Region:  action.Options.Region,
+			Zone:    action.Options.Zone,
+		})
+	case ActionApplyProfile:
+		if exportMode {
+			return gcp.ExportContext(r, action.Options.Profile)
+		}
+		return gcp.ApplyContext(r, action.Options.Profile)
 	}
 	return nil
 }
 
 // GetConfirmationText returns the confirmation text
 func (sm *AppStateMachine) GetConfirmationText() string {
-	return sm.context.ConfirmText
+	return sm.context.Pending.Prompt
 }
 
 // GenerateDOTGraph generates a DOT graph representation of the state machine
@@ -24,7 +24,7 @@ func TestStateMachine(t *testing.T) {
 	}
 
 	// Test menu choice with guard conditions
-	sm.SetMenuChoice(0) // Accounts
+	sm.SetMenuChoice(0)      // Accounts
 	sm.SetHasAccounts(false) // No accounts available
 
 	if !sm.CanFire(TriggerLoadAccounts) {
@@ -50,8 +50,11 @@ func TestStateMachine(t *testing.T) {
 	}
 
 	// Test selection
-	sm.SetSelectedID("test@example.com")
-	err = sm.Fire(TriggerAccountSelected, "Switch to test@example.com?")
+	err = sm.Fire(TriggerAccountSelected, PendingAction{
+		Kind:   ActionSwitchAccount,
+		Target: "test@example.com",
+		Prompt: "Switch to test@example.com?",
+	})
 	if err != nil {
 		t.Errorf("Failed to transition to confirming state: %v", err)
 	}
@@ -111,4 +114,35 @@ func TestStateMachineErrorHandling(t *testing.T) {
 	if sm.GetState() != StateLoading {
 		t.Errorf("State should remain StateLoading after invalid transition, got %v", sm.GetState())
 	}
-}
\ No newline at end of file
+}
+
+func TestStateMachineTypedConfirmation(t *testing.T) {
+	sm := NewAppStateMachine()
+	sm.Fire(TriggerDataLoaded)
+	sm.SetHasProjects(true)
+	sm.SetMenuChoice(MenuProjects)
+	sm.Fire(TriggerMenuChoice)
+
+	err := sm.Fire(TriggerProjectSelected, PendingAction{
+		Kind:    ActionSwitchProject,
+		Target:  "billing-prod",
+		Confirm: ConfirmTyped,
+		Prompt:  "Switch to project billing-prod?",
+	})
+	if err != nil {
+		t.Fatalf("Failed to transition to confirming state: %v", err)
+	}
+
+	sm.SetConfirmTyped("billing")
+	if sm.CanFire(TriggerConfirmYes) {
+		t.Error("Should not confirm until the project ID is typed exactly")
+	}
+
+	sm.SetConfirmTyped("billing-prod")
+	if err := sm.Fire(TriggerConfirmYes); err != nil {
+		t.Fatalf("Failed to confirm after typing the project ID: %v", err)
+	}
+	if sm.GetContext().Pending.Kind != ActionSwitchProject {
+		t.Errorf("Expected the pending action to reach processing, got %v", sm.GetContext().Pending.Kind)
+	}
+}
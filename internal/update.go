@@ -1,12 +1,24 @@
 package internal
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/cache"
+	"github.com/mathd/gcp-switcher/internal/hierarchy"
+	"github.com/mathd/gcp-switcher/internal/history"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
 	"github.com/mathd/gcp-switcher/types"
 )
 
@@ -27,6 +39,41 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case StateManualProject:
 		m.Components.ProjectInput, cmd = m.Components.ProjectInput.Update(msg)
 		cmds = append(cmds, cmd)
+	case StateConfigurations:
+		m.Components.ConfigurationList, cmd = m.Components.ConfigurationList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateConfigurationName:
+		m.Components.ConfigurationInput, cmd = m.Components.ConfigurationInput.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateQuotaProject:
+		m.Components.QuotaInput, cmd = m.Components.QuotaInput.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateCredentials:
+		m.Components.CredentialList, cmd = m.Components.CredentialList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateAllProjects:
+		m.Components.AllProjectsList, cmd = m.Components.AllProjectsList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateProfiles:
+		m.Components.ProfileList, cmd = m.Components.ProfileList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateKeyFile:
+		m.Components.KeyFileInput, cmd = m.Components.KeyFileInput.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateHierarchy:
+		m.Components.HierarchyList, cmd = m.Components.HierarchyList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateRegions:
+		m.Components.RegionList, cmd = m.Components.RegionList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateZones:
+		m.Components.ZoneList, cmd = m.Components.ZoneList.Update(msg)
+		cmds = append(cmds, cmd)
+	case StateConfirming:
+		if m.StateMachine.GetContext().Pending.Confirm == ConfirmTyped {
+			m.Components.ConfirmInput, cmd = m.Components.ConfirmInput.Update(msg)
+			cmds = append(cmds, cmd)
+		}
 	}
 
 	switch msg := msg.(type) {
@@ -47,13 +94,27 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.UI.Height = msg.Height
 		m.Components.AccountList.SetSize(msg.Width-4, listHeight)
 		m.Components.ProjectList.SetSize(msg.Width-4, listHeight)
+		m.Components.ConfigurationList.SetSize(msg.Width-4, listHeight)
+		m.Components.HierarchyList.SetSize(msg.Width-4, listHeight)
+		m.Components.RegionList.SetSize(msg.Width-4, listHeight)
+		m.Components.ZoneList.SetSize(msg.Width-4, listHeight)
+		m.Components.CredentialList.SetSize(msg.Width-4, listHeight)
+		m.Components.AllProjectsList.SetSize(msg.Width-4, listHeight)
+		m.Components.ProfileList.SetSize(msg.Width-4, listHeight)
 
 	case types.ErrMsg:
 		m.Operations.CommandErrors = append(m.Operations.CommandErrors, msg.Err.Error())
+		// A failed refresh leaves the cached lists in place
+		m.Data.AccountsSource.Refreshing = false
+		m.Data.ProjectsSource.Refreshing = false
 		m.Operations.CommandsComplete++
 		if m.Operations.CommandsComplete >= m.Operations.TotalCommands {
 			m.StateMachine.Fire(TriggerDataLoaded)
 		}
+		if m.UI.RestoreProject != "" && currentState == StateProcessing {
+			// Without the project list the restored project's labels stay unknown
+			cmds = append(cmds, m.restoreProject())
+		}
 
 	case spinner.TickMsg:
 		m.Components.Spinner, cmd = m.Components.Spinner.Update(msg)
@@ -70,11 +131,14 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case types.ActiveAccountMsg:
 		m.Data.ActiveAccount = msg.Account
+		m.updateAccountList()
 		m.Operations.CommandsComplete++
 		CheckCompletion(&m)
 
 	case types.ActiveProjectMsg:
 		m.Data.ActiveProject = msg.Project
+		m.updateAccountList() // Impersonation targets are configured per project
+		cmds = append(cmds, m.requestHierarchy())
 		m.Operations.CommandsComplete++
 		CheckCompletion(&m)
 
@@ -82,9 +146,23 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Data.Accounts = msg.Accounts
 		m.StateMachine.SetHasAccounts(len(m.Data.Accounts) > 0)
 		m.updateAccountList()
+		m.Data.AccountsSource = ListSource{CachedAt: msg.CachedAt}
+		if msg.CachedAt.IsZero() {
+			cmds = append(cmds, cacheAccounts(msg.Accounts))
+			m.StateMachine.SetHasAllProjects(false) // Accounts may have come or gone
+		} else if m.isStale(msg.CachedAt) {
+			m.Data.AccountsSource.Refreshing = true
+			cmds = append(cmds, gcp.GetAllAccounts(m.Gcloud))
+		}
 		if currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingAccounts {
 			m.StateMachine.Fire(TriggerDataLoaded)
 		}
+		if m.UI.ShowLoggedInAccount && msg.CachedAt.IsZero() && currentState == StateMain {
+			m.UI.ShowLoggedInAccount = false
+			m.selectAccount(m.loggedInAccount())
+			m.StateMachine.SetMenuChoice(MenuAccounts)
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
 		m.Operations.CommandsComplete++
 		CheckCompletion(&m)
 
@@ -92,42 +170,275 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Data.Projects = msg.Projects
 		m.StateMachine.SetHasProjects(len(m.Data.Projects) > 0)
 		m.updateProjectList()
+		m.updateHierarchyList()
+		m.Data.ProjectsSource = ListSource{CachedAt: msg.CachedAt}
+		if !msg.CachedAt.IsZero() {
+			if m.isStale(msg.CachedAt) {
+				m.Data.ProjectsSource.Refreshing = true
+				cmds = append(cmds, gcp.GetSimpleProjects(m.Gcloud))
+			}
+		} else if m.Data.ActiveAccount != "" {
+			cmds = append(cmds, cacheProjects(m.Data.ActiveAccount, msg.Projects))
+		}
 		if currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingProjects {
 			m.StateMachine.Fire(TriggerDataLoaded)
 		}
 		m.Operations.CommandsComplete++
+		if m.UI.RestoreProject != "" && currentState == StateProcessing {
+			cmds = append(cmds, m.restoreProject())
+		}
 
 		// If we need to show project selection after account switch
 		if m.UI.NeedProjectSelection && len(m.Data.Projects) > 0 && currentState == StateMain {
 			m.UI.NeedProjectSelection = false // Clear the flag
-			m.StateMachine.SetMenuChoice(1) // Projects menu choice
+			m.StateMachine.SetMenuChoice(MenuProjects)
 			m.StateMachine.Fire(TriggerMenuChoice)
 		} else if m.Data.ActiveProject != "" {
 			CheckCompletion(&m)
 		}
 
+	case types.HierarchyMsg:
+		m.Data.HierarchyLoading = false
+		m.Data.Organizations = msg.Organizations
+		m.Data.Folders = msg.Folders
+		m.Data.HierarchyErr = msg.Err
+		m.StateMachine.SetHasHierarchy(true)
+		if !msg.CachedAt.IsZero() {
+			if m.isStale(msg.CachedAt) {
+				cmds = append(cmds, gcp.GetHierarchy(m.Gcloud))
+			}
+		} else if msg.Err == nil && m.Data.ActiveAccount != "" {
+			// Partial trees are not cached so that the next run lists them again
+			cmds = append(cmds, cacheHierarchy(m.Data.ActiveAccount, msg.Organizations, msg.Folders))
+		}
+		m.expandToActiveProject()
+		if currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingHierarchy {
+			// The tree is only loaded on demand, so open it right away
+			m.StateMachine.Fire(TriggerDataLoaded)
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+
+	case types.VerificationMsg:
+		m.Data.Drift = msg.Drift
+		if msg.Err != nil {
+			m.Data.Drift = []types.Drift{{Message: "Could not verify the active account and project: " + msg.Err.Error()}}
+		}
+
+	case types.PropertyMsg:
+		switch msg.Property {
+		case gcp.PropertyRegion:
+			m.Data.ActiveRegion = msg.Value
+		case gcp.PropertyZone:
+			m.Data.ActiveZone = msg.Value
+		case gcp.PropertyImpersonation:
+			m.Data.Impersonating = msg.Value
+			m.updateAccountList()
+		}
+		m.updateRegionList()
+
+	case types.LocationListMsg:
+		loading := currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingLocations
+		m.Data.LocationsSource.Refreshing = false
+		if msg.Err != nil {
+			// A failed refresh keeps the cached lists
+			if loading {
+				m.UI.Err = msg.Err
+				m.StateMachine.Fire(TriggerError, msg.Err)
+			}
+			break
+		}
+
+		m.Data.Regions = msg.Regions
+		m.Data.Zones = msg.Zones
+		m.StateMachine.SetHasLocations(len(m.Data.Regions) > 0)
+		m.updateRegionList()
+		m.Data.LocationsSource = ListSource{CachedAt: msg.CachedAt}
+		if msg.CachedAt.IsZero() {
+			if m.Data.ActiveProject != "" {
+				cmds = append(cmds, cacheLocations(m.Data.ActiveProject, msg.Regions, msg.Zones))
+			}
+		} else if m.isStale(msg.CachedAt) {
+			m.Data.LocationsSource.Refreshing = true
+			cmds = append(cmds, gcp.GetLocations(m.Gcloud))
+		}
+		if loading {
+			// Locations are only loaded on demand, so open them right away
+			m.StateMachine.Fire(TriggerDataLoaded)
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+
+	case types.PinMsg:
+		m.Data.Pin = msg
+
+	case types.CredentialListMsg:
+		loading := currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingCredentials
+		if msg.Err != nil {
+			if loading {
+				m.UI.Err = msg.Err
+				m.StateMachine.Fire(TriggerError, msg.Err)
+			}
+			break
+		}
+		m.Data.Credentials = msg.Credentials
+		m.StateMachine.SetHasCredentials(true)
+		m.updateCredentialList()
+		if loading {
+			m.StateMachine.Fire(TriggerDataLoaded)
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+
+	case types.ProjectSearchMsg:
+		m.Data.AllProjects = msg.Results
+		m.StateMachine.SetHasAllProjects(true)
+		m.updateAllProjectsList()
+		for _, result := range msg.Results {
+			if result.Err == nil && result.CachedAt.IsZero() {
+				cmds = append(cmds, cacheProjects(result.Account, result.Projects))
+			}
+		}
+		if currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingAllProjects {
+			// The search is only run on demand, so open it right away
+			m.StateMachine.Fire(TriggerDataLoaded)
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+
+	case types.AccountCheckMsg:
+		m.UI.CheckingAccounts = false
+		m.UI.AccountCheckErr = msg.Err
+		m.UI.InvalidAccounts = msg.Invalid
+
+	case types.ADCMsg:
+		previous := m.Data.ADC
+		m.Data.ADC = msg.ADC
+		m.Data.ADCErr = msg.Err
+		if msg.ADC.Type == "authorized_user" && msg.ADC.Account == "" {
+			switch {
+			case msg.ADC.Path == previous.Path && msg.ADC.Type == previous.Type && previous.Account != "":
+				// The identity looked up for this file still holds
+				m.Data.ADC.Account = previous.Account
+			case msg.ADC.Path != previous.Path || currentState == StateADC:
+				// The lookup takes a network call, so it runs in the background
+				// once per file, and again on the ADC screen if it failed
+				cmds = append(cmds, gcp.LookupADCAccount(m.Gcloud, m.HTTP, msg.ADC.Path))
+			}
+		}
+
+	case types.SettingsSavedMsg:
+		m.UI.SaveErr = msg.Err
+
+	case types.ADCAccountMsg:
+		// An unknown identity is not an error: the screen just cannot compare it
+		if msg.Err == nil && msg.Path == m.Data.ADC.Path {
+			m.Data.ADC.Account = msg.Account
+		}
+
+	case types.ConfigurationListMsg:
+		m.Data.Configurations = msg.Configurations
+		m.Data.ActiveConfiguration = ""
+		for _, configuration := range m.Data.Configurations {
+			if configuration.IsActive {
+				m.Data.ActiveConfiguration = configuration.Name
+			}
+		}
+		m.StateMachine.SetHasConfigurations(len(m.Data.Configurations) > 0)
+		m.updateConfigurationList()
+		if currentState == StateLoading && m.StateMachine.GetContext().LoadingContext == LoadingConfigurations {
+			m.StateMachine.Fire(TriggerDataLoaded)
+		}
+		m.Operations.CommandsComplete++
+		CheckCompletion(&m)
+
 	case types.OperationResultMsg:
 		if msg.Success {
-			if msg.Message == "ACCOUNT_SWITCHED" {
+			m.export(msg.Env)
+
+			pending := m.StateMachine.GetContext().Pending
+			switch msg.Kind {
+			case types.ResultAccountSwitched:
+				cmds = append(cmds, m.recordHistory(pending.Target, ""))
+			case types.ResultProjectSwitched:
+				projectID := pending.Target
+				if pending.Options.Account != "" {
+					// The account was switched along with the project
+					m.Data.ActiveAccount = pending.Options.Account
+					m.StateMachine.SetHasHierarchy(false)
+				}
+				cmds = append(cmds, m.recordHistory(m.Data.ActiveAccount, projectID))
+				if m.Settings.ExportMode() && pending.Options.Region != "" {
+					// The remembered location is exported with the project
+					m.export(map[string]string{gcp.EnvRegion: pending.Options.Region, gcp.EnvZone: pending.Options.Zone})
+				}
+				m.StateMachine.SetHasLocations(false) // Locations are listed per project
+			case types.ResultLoggedIn:
+				if !m.Settings.Login.SkipADC {
+					m.Data.ADC = types.ADC{} // The new credentials are looked up again
+				}
+				// The refreshed account list opens with the new account selected
+				m.UI.ShowLoggedInAccount = true
+				m.UI.AccountsBeforeLogin = nil
+				for _, account := range m.Data.Accounts {
+					m.UI.AccountsBeforeLogin = append(m.UI.AccountsBeforeLogin, account.Account)
+				}
+			case types.ResultProfileApplied:
+				profile := pending.Options.Profile
+				m.Data.ActiveAccount = profile.Account
+				m.Data.Impersonating = profile.Impersonate
+				cmds = append(cmds, m.recordHistory(profile.Account, profile.Project))
+				m.StateMachine.SetHasLocations(false) // Locations are listed per project
+				m.StateMachine.SetHasHierarchy(false) // The account may see other organizations
+			case types.ResultADCChanged:
+				m.Data.ADC = types.ADC{} // The new credentials are looked up again
+			case types.ResultCredentialsChanged:
+				m.StateMachine.SetHasCredentials(false)
+			case types.ResultImpersonationSet:
+				m.Data.Impersonating = pending.Target
+				m.updateAccountList()
+			case types.ResultLocationSet:
+				// Locations applied after a project switch are already remembered
+				if pending.Kind == ActionSetLocation {
+					cmds = append(cmds, m.rememberLocation(m.Data.ActiveProject, userconfig.Location{Region: pending.Target, Zone: pending.Options.Zone}))
+				}
+			}
+			if _, ok := msg.Env[gcp.EnvProject]; ok {
+				return m, tea.Sequence(tea.Batch(cmds...), tea.Quit)
+			}
+
+			if msg.Kind == types.ResultAccountSwitched {
+				m.Data.ActiveAccount = pending.Target
 				m.Data.ActiveProject = ""
 				m.Data.Projects = nil
 				m.Components.ProjectList.SetItems([]list.Item{})
-				m.StateMachine.SetSelectedID("") // Clear selected ID after account switch
-				m.StateMachine.SetHasProjects(false) // Mark projects as needing reload
-				m.UI.NeedProjectSelection = true // Flag to show project selection
-				m.StateMachine.Fire(TriggerOperationComplete) // Return to main first
+				m.UI.HierarchyFocus = ""
+				m.StateMachine.SetHasProjects(false)  // Mark projects as needing reload
+				m.StateMachine.SetHasHierarchy(false) // The new account may see other organizations
+				if projectID, ok := m.restorableProject(pending.Target); ok {
+					// Protection rules need the labels and parent the new account
+					// sees, so the project is restored once its projects are listed
+					m.UI.RestoreProject = projectID
+				} else {
+					m.UI.NeedProjectSelection = true              // Flag to show project selection
+					m.StateMachine.Fire(TriggerOperationComplete) // Return to main first
+				}
 				cmds = append(cmds, tea.Batch(
-					gcp.GetActiveAccount(),
+					gcp.GetActiveAccount(m.Gcloud),
 					// Don't get active project - we want to force project selection
-					gcp.GetSimpleProjects(),
+					gcp.GetSimpleProjects(m.Gcloud),
+					gcp.GetConfigurations(m.Gcloud),
+					gcp.VerifySwitch(m.Gcloud, gcp.Context{Account: pending.Target}),
 				))
 			} else {
 				m.StateMachine.Fire(TriggerOperationComplete)
 				cmds = append(cmds, tea.Batch(
-					gcp.GetActiveAccount(),
-					gcp.GetActiveProject(),
-					gcp.GetAllAccounts(),
-					gcp.GetSimpleProjects(),
+					gcp.GetActiveAccount(m.Gcloud),
+					gcp.GetActiveProject(m.Gcloud),
+					gcp.GetAllAccounts(m.Gcloud),
+					gcp.GetSimpleProjects(m.Gcloud),
+					gcp.GetConfigurations(m.Gcloud),
+					optionalProperty(m.Gcloud, gcp.PropertyRegion),
+					optionalProperty(m.Gcloud, gcp.PropertyZone),
+					optionalProperty(m.Gcloud, gcp.PropertyImpersonation),
+					gcp.GetADC(m.Gcloud),
+					gcp.VerifySwitch(m.Gcloud, switchedContext(pending, msg.Kind)),
 				))
 			}
 		} else {
@@ -147,28 +458,473 @@ func (m AppModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 func (m *AppModel) updateAccountList() {
 	accountItems := make([]list.Item, len(m.Data.Accounts))
 	for i, account := range m.Data.Accounts {
+		description := ""
+		if account.Status == "ACTIVE" && m.Data.Impersonating != "" {
+			description = "Acting as " + m.Data.Impersonating
+		}
 		accountItems[i] = types.NewItem(
 			account.Account,
-			"",
+			description,
 			account.Status == "ACTIVE",
 			account.Account,
 		)
 	}
+	for _, serviceAccount := range m.impersonationTargets() {
+		accountItems = append(accountItems, types.NewItem(
+			serviceAccount,
+			"Service account • impersonate via "+m.Data.ActiveAccount,
+			serviceAccount == m.Data.Impersonating,
+			serviceAccount,
+		))
+	}
 	m.Components.AccountList.SetItems(accountItems)
 }
 
-// updateProjectList updates the project list items
+// loggedInAccount returns the account added by the last login, or the active
+// account when an existing account logged in again
+func (m AppModel) loggedInAccount() string {
+	active := ""
+	for _, account := range m.Data.Accounts {
+		if !slices.Contains(m.UI.AccountsBeforeLogin, account.Account) {
+			return account.Account
+		}
+		if account.Status == "ACTIVE" {
+			active = account.Account
+		}
+	}
+	return active
+}
+
+// selectAccount moves the account list selection to an account
+func (m *AppModel) selectAccount(account string) {
+	for i, item := range m.Components.AccountList.Items() {
+		if item.(types.Item).ID() == account {
+			m.Components.AccountList.Select(i)
+			return
+		}
+	}
+}
+
+// loginOptions returns how logins run according to the user settings
+func (m AppModel) loginOptions() gcp.LoginOptions {
+	return gcp.LoginOptions{Flags: m.Settings.Login.Flags(), SkipADC: m.Settings.Login.SkipADC}
+}
+
+// impersonationTargets returns the service accounts configured for the active
+// project that are not authenticated accounts themselves. The service account
+// being impersonated is always included so that it can be cleared.
+func (m *AppModel) impersonationTargets() []string {
+	targets := slices.Clone(m.Settings.Impersonation[m.Data.ActiveProject])
+	if m.Data.Impersonating != "" && !slices.Contains(targets, m.Data.Impersonating) {
+		targets = append(targets, m.Data.Impersonating)
+	}
+	return slices.DeleteFunc(targets, func(target string) bool {
+		return slices.ContainsFunc(m.Data.Accounts, func(a types.Account) bool { return a.Account == target })
+	})
+}
+
+// confirmImpersonation asks to impersonate a service account, or to stop when
+// it is the one already impersonated
+func (m AppModel) confirmImpersonation(serviceAccount string) AppModel {
+	if serviceAccount == m.Data.Impersonating {
+		m.StateMachine.Fire(TriggerAccountSelected, PendingAction{
+			Kind:   ActionImpersonate,
+			Prompt: fmt.Sprintf("Stop acting as %s and use %s again?", serviceAccount, m.Data.ActiveAccount),
+		})
+		return m
+	}
+	m.StateMachine.Fire(TriggerAccountSelected, PendingAction{
+		Kind:   ActionImpersonate,
+		Target: serviceAccount,
+		Prompt: fmt.Sprintf("Act as %s via %s?", serviceAccount, m.Data.ActiveAccount),
+	})
+	return m
+}
+
+// updateProjectList updates the project list items. Favorites come first,
+// in the order they were starred, followed by recently used projects. The
+// selection stays on the same project.
 func (m *AppModel) updateProjectList() {
-	projectItems := make([]list.Item, len(m.Data.Projects))
-	for i, project := range m.Data.Projects {
+	selectedID := ""
+	if selectedItem, ok := m.Components.ProjectList.SelectedItem().(types.Item); ok {
+		selectedID = selectedItem.ID()
+	}
+
+	projects := slices.Clone(m.Data.Projects)
+	slices.SortStableFunc(projects, func(a, b types.Project) int {
+		return m.projectRank(a.ProjectID) - m.projectRank(b.ProjectID)
+	})
+
+	projectItems := make([]list.Item, len(projects))
+	selected := 0
+	for i, project := range projects {
+		title := project.ProjectID
+		if m.Settings.IsFavorite(project.ProjectID) {
+			title = "★ " + title
+		}
 		projectItems[i] = types.NewItem(
-			project.ProjectID,
-			project.Name,
+			title,
+			describeProject(project),
 			project.ProjectID == m.Data.ActiveProject,
 			project.ProjectID,
 		)
+		if project.ProjectID == selectedID {
+			selected = i
+		}
 	}
 	m.Components.ProjectList.SetItems(projectItems)
+	m.Components.ProjectList.Select(selected)
+}
+
+// updateHierarchyList rebuilds the organization tree and its visible rows.
+// When the tree is narrowed to a folder, everything beneath it is shown.
+func (m *AppModel) updateHierarchyList() {
+	m.Data.Hierarchy = hierarchy.Build(m.Data.Organizations, m.Data.Folders, m.Data.Projects)
+
+	roots := m.Data.Hierarchy
+	expanded := func(node *hierarchy.Node) bool { return m.UI.Expanded[node.ID] }
+	m.Components.HierarchyList.Title = "Organization Tree"
+	if focus := hierarchy.Find(m.Data.Hierarchy, m.UI.HierarchyFocus); focus != nil {
+		roots = focus.Children
+		expanded = func(*hierarchy.Node) bool { return true }
+		m.Components.HierarchyList.Title = "Organization Tree: " + focus.Name
+	}
+
+	selectedID := ""
+	if selectedItem, ok := m.Components.HierarchyList.SelectedItem().(types.Item); ok {
+		selectedID = selectedItem.ID()
+	}
+
+	rows := hierarchy.Flatten(roots, expanded)
+	items := make([]list.Item, len(rows))
+	for i, row := range rows {
+		node := row.Node
+		indent := strings.Repeat("  ", row.Depth)
+		if node.IsContainer() {
+			marker := "▸ "
+			if expanded(node) {
+				marker = "▾ "
+			}
+			kind := "folder"
+			if node.Kind == hierarchy.KindOrganization {
+				kind = "organization"
+			}
+			count := len(node.Projects())
+			description := fmt.Sprintf("%s • %d projects", kind, count)
+			if count == 1 {
+				description = kind + " • 1 project"
+			}
+			items[i] = types.NewItem(indent+marker+node.Name, indent+"  "+description, false, node.ID)
+			continue
+		}
+		items[i] = types.NewItem(indent+"  "+node.ID, indent+"  "+describeProject(node.Project), node.ID == m.Data.ActiveProject, node.ID)
+	}
+	m.Components.HierarchyList.SetItems(items)
+	m.selectHierarchyItem(selectedID)
+}
+
+// selectHierarchyItem moves the tree selection to the node with the given ID, if visible
+func (m *AppModel) selectHierarchyItem(id string) {
+	for i, item := range m.Components.HierarchyList.Items() {
+		if item.(types.Item).ID() == id {
+			m.Components.HierarchyList.Select(i)
+			return
+		}
+	}
+}
+
+// expandToActiveProject expands the organizations and the folders leading to
+// the active project, and selects it
+func (m *AppModel) expandToActiveProject() {
+	for _, root := range m.Data.Hierarchy {
+		if root.Kind == hierarchy.KindOrganization {
+			m.UI.Expanded[root.ID] = true
+		}
+	}
+	path := hierarchy.Path(m.Data.Hierarchy, m.Data.ActiveProject)
+	for _, node := range path {
+		if node.IsContainer() {
+			m.UI.Expanded[node.ID] = true
+		}
+	}
+	m.updateHierarchyList()
+	m.selectHierarchyItem(m.Data.ActiveProject)
+}
+
+// projectRank orders favorites by position, then recently used projects by
+// recency, ahead of every other project
+func (m *AppModel) projectRank(projectID string) int {
+	favorites := len(m.Settings.Favorites)
+	if i := slices.Index(m.Settings.Favorites, projectID); i >= 0 {
+		return i
+	}
+	if i := m.Data.History.ProjectRank(projectID); i >= 0 {
+		return favorites + i
+	}
+	return favorites + len(m.Data.History.Entries)
+}
+
+// updateConfigurationList updates the configuration list items
+func (m *AppModel) updateConfigurationList() {
+	configurationItems := make([]list.Item, len(m.Data.Configurations))
+	for i, configuration := range m.Data.Configurations {
+		configurationItems[i] = types.NewItem(
+			configuration.Name,
+			describeConfiguration(configuration),
+			configuration.IsActive,
+			configuration.Name,
+		)
+	}
+	m.Components.ConfigurationList.SetItems(configurationItems)
+}
+
+// updateAllProjectsList lists the projects of every account, each tagged with
+// the account that sees it. A project visible to several accounts is listed
+// once per account.
+func (m *AppModel) updateAllProjectsList() {
+	var items []list.Item
+	for _, result := range m.Data.AllProjects {
+		for _, project := range result.Projects {
+			items = append(items, types.NewItem(
+				project.ProjectID,
+				"via "+result.Account+" • "+describeProject(project),
+				result.Account == m.Data.ActiveAccount && project.ProjectID == m.Data.ActiveProject,
+				project.ProjectID+"/"+result.Account,
+			))
+		}
+	}
+	m.Components.AllProjectsList.SetItems(items)
+}
+
+// updateProfileList lists the profiles in the order they are defined
+func (m *AppModel) updateProfileList() {
+	items := make([]list.Item, len(m.Settings.Profiles))
+	for i, profile := range m.Settings.Profiles {
+		items[i] = types.NewItem(
+			profile.Name,
+			describeProfile(profile),
+			profile.Account == m.Data.ActiveAccount && profile.Project == m.Data.ActiveProject,
+			profile.Name,
+		)
+	}
+	m.Components.ProfileList.SetItems(items)
+}
+
+// describeProfile summarizes what a profile switches to
+func describeProfile(profile userconfig.Profile) string {
+	parts := []string{profile.Account, profile.Project}
+	if location := cmp.Or(profile.Zone, profile.Region); location != "" {
+		parts = append(parts, location)
+	}
+	if profile.Impersonate != "" {
+		parts = append(parts, "as "+profile.Impersonate)
+	}
+	if profile.QuotaProject != "" {
+		parts = append(parts, "ADC quota "+profile.QuotaProject)
+	}
+	return strings.Join(parts, " • ")
+}
+
+// confirmProfile asks to apply a profile. A protected project still needs
+// its ID typed.
+func (m AppModel) confirmProfile(profile userconfig.Profile) AppModel {
+	return m.confirmSwitch(TriggerProfileSelected, PendingAction{
+		Kind:   ActionApplyProfile,
+		Target: profile.Project,
+		Options: ActionOptions{Profile: gcp.Context{
+			Account:      profile.Account,
+			Project:      profile.Project,
+			Region:       profile.Region,
+			Zone:         profile.Zone,
+			Impersonate:  profile.Impersonate,
+			QuotaProject: profile.QuotaProject,
+		}},
+		Prompt: fmt.Sprintf("Switch to profile %s (%s)?", profile.Name, describeProfile(profile)),
+	})
+}
+
+// updateCredentialList updates the credential inventory items
+func (m *AppModel) updateCredentialList() {
+	credentialItems := make([]list.Item, len(m.Data.Credentials))
+	for i, credential := range m.Data.Credentials {
+		credentialItems[i] = types.NewItem(
+			credential.Account,
+			credentialTypeNames[credential.Type],
+			credential.Status == "ACTIVE",
+			credential.Account,
+		)
+	}
+	m.Components.CredentialList.SetItems(credentialItems)
+}
+
+// credentialTypeNames describes each type of credentials in the inventory
+var credentialTypeNames = map[string]string{
+	types.CredentialUser:           "User account",
+	types.CredentialServiceAccount: "Service account",
+	types.CredentialExternal:       "External account (workload identity federation)",
+}
+
+// updateRegionList updates the region list items
+func (m *AppModel) updateRegionList() {
+	zones := map[string]int{}
+	for _, zone := range m.Data.Zones {
+		zones[zone.RegionName()]++
+	}
+
+	regionItems := make([]list.Item, len(m.Data.Regions))
+	for i, region := range m.Data.Regions {
+		regionItems[i] = types.NewItem(
+			region.Name,
+			fmt.Sprintf("%d zones • %s", zones[region.Name], region.Status),
+			region.Name == m.Data.ActiveRegion,
+			region.Name,
+		)
+	}
+	m.Components.RegionList.SetItems(regionItems)
+}
+
+// updateZoneList lists the zones of a region, after an entry that leaves the
+// default zone unset
+func (m *AppModel) updateZoneList(region string) {
+	m.UI.SelectedRegion = region
+	m.Components.ZoneList.Title = "Zones in " + region
+
+	zoneItems := []list.Item{types.NewItem("No default zone", "Clear compute/zone", region == m.Data.ActiveRegion && m.Data.ActiveZone == "", "")}
+	for _, zone := range m.Data.Zones {
+		if zone.RegionName() == region {
+			zoneItems = append(zoneItems, types.NewItem(zone.Name, zone.Status, zone.Name == m.Data.ActiveZone, zone.Name))
+		}
+	}
+	m.Components.ZoneList.SetItems(zoneItems)
+	m.Components.ZoneList.ResetFilter()
+	m.Components.ZoneList.Select(0)
+}
+
+// export records variables exported to the calling shell. They also apply
+// to the gcloud commands run from now on.
+func (m *AppModel) export(env map[string]string) {
+	if len(env) == 0 {
+		return
+	}
+	maps.Copy(m.Data.Exports, env)
+	m.Gcloud = m.Gcloud.WithEnv(m.Data.Exports)
+}
+
+// projectLocation returns the region and zone remembered for a project, when
+// they differ from the active ones and so have to be set along with it
+func (m AppModel) projectLocation(projectID string) (userconfig.Location, bool) {
+	location, ok := m.Settings.ProjectLocations[projectID]
+	if !ok || (location.Region == m.Data.ActiveRegion && location.Zone == m.Data.ActiveZone) {
+		return userconfig.Location{}, false
+	}
+	return location, true
+}
+
+// rememberLocation stores the region and zone chosen for a project and persists them
+func (m *AppModel) rememberLocation(projectID string, location userconfig.Location) tea.Cmd {
+	if projectID == "" {
+		return nil
+	}
+	m.Settings.SetProjectLocation(projectID, location)
+	return func() tea.Msg {
+		if err := userconfig.Update(func(c *userconfig.Config) { c.SetProjectLocation(projectID, location) }); err != nil {
+			return types.SettingsSavedMsg{Err: fmt.Errorf("failed to save the project location: %w", err)}
+		}
+		return types.SettingsSavedMsg{}
+	}
+}
+
+// describeProject summarizes the name, number, labels, creation date and, when
+// it is not active, the lifecycle state of a project. Labels are rendered as
+// key:value so that the project list filter can match them.
+func describeProject(project types.Project) string {
+	parts := []string{project.Name}
+	if project.LifecycleState != "" && project.LifecycleState != "ACTIVE" {
+		parts = append(parts, project.LifecycleState)
+	}
+	if project.ProjectNumber != "" {
+		parts = append(parts, "#"+project.ProjectNumber)
+	}
+	if len(project.Labels) > 0 {
+		var labels []string
+		for _, key := range slices.Sorted(maps.Keys(project.Labels)) {
+			labels = append(labels, key+":"+project.Labels[key])
+		}
+		parts = append(parts, strings.Join(labels, " "))
+	}
+	if !project.CreateTime.IsZero() {
+		parts = append(parts, "created "+project.CreateTime.Format("2006-01-02"))
+	}
+	return strings.Join(parts, " • ")
+}
+
+// describeConfiguration summarizes the account, project and region of a configuration
+func describeConfiguration(configuration types.Configuration) string {
+	props := configuration.Properties
+	parts := []string{
+		orUnset(props.Core.Account),
+		orUnset(props.Core.Project),
+		orUnset(props.Compute.Region),
+	}
+	return strings.Join(parts, " • ")
+}
+
+// orUnset returns value, or a placeholder when it is empty
+func orUnset(value string) string {
+	if value == "" {
+		return "(unset)"
+	}
+	return value
+}
+
+// recordHistory adds a successful switch to the in-memory history and persists it
+func (m *AppModel) recordHistory(account, project string) tea.Cmd {
+	now := time.Now()
+	m.Data.History.Add(history.Entry{Time: now, Account: account, Project: project})
+	return func() tea.Msg {
+		if err := history.Record(account, project, now); err != nil {
+			return types.SettingsSavedMsg{Err: fmt.Errorf("failed to save the history: %w", err)}
+		}
+		return nil
+	}
+}
+
+// isStale reports whether a cached list is old enough to be refreshed
+func (m AppModel) isStale(cachedAt time.Time) bool {
+	return time.Since(cachedAt) >= m.Settings.CacheMaxAge()
+}
+
+// cacheAccounts persists the account list for the next startup and shell completion
+func cacheAccounts(accounts []types.Account) tea.Cmd {
+	return func() tea.Msg {
+		cache.Update(func(c *cache.Cache) { c.SetAccounts(accounts, time.Now()) })
+		return nil
+	}
+}
+
+// cacheLocations persists the regions and zones listed for a project
+func cacheLocations(projectID string, regions []types.Region, zones []types.Zone) tea.Cmd {
+	return func() tea.Msg {
+		cache.Update(func(c *cache.Cache) { c.SetLocations(projectID, regions, zones, time.Now()) })
+		return nil
+	}
+}
+
+// cacheHierarchy persists the organization tree listed for an account
+func cacheHierarchy(account string, organizations []types.Organization, folders []types.Folder) tea.Cmd {
+	return func() tea.Msg {
+		cache.Update(func(c *cache.Cache) { c.SetHierarchy(account, organizations, folders, time.Now()) })
+		return nil
+	}
+}
+
+// cacheProjects persists the project list shown for an account, so shell
+// completion offers the same projects as the project list
+func cacheProjects(account string, projects []types.Project) tea.Cmd {
+	return func() tea.Msg {
+		cache.Update(func(c *cache.Cache) { c.SetProjects(account, projects, time.Now()) })
+		return nil
+	}
 }
 
 // handleFallbackTimer handles fallback timer messages
@@ -184,7 +940,58 @@ func (m AppModel) handleFallbackTimer(msg types.FallbackTimerMsg) (tea.Model, te
 func (m AppModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	currentState := m.StateMachine.GetState()
 
-	switch msg.String() {
+	if currentState == StateConfigurationName {
+		return m.handleConfigurationNameKey(msg)
+	}
+	if currentState == StateQuotaProject {
+		return m.handleQuotaProjectKey(msg)
+	}
+	if currentState == StateKeyFile {
+		return m.handleKeyFileKey(msg)
+	}
+	if currentState == StateCredentials && m.Components.CredentialList.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "n", "x", "delete":
+			return m.handleCredentialKey(msg.String())
+		}
+	}
+	if currentState == StateADC {
+		switch msg.String() {
+		case "l", "x", "p":
+			return m.handleADCKey(msg.String())
+		}
+	}
+	if currentState == StateConfirming && m.StateMachine.GetContext().Pending.Confirm == ConfirmTyped {
+		return m.handleTypedConfirmationKey(msg)
+	}
+	if currentState == StateProjects && msg.String() == "s" && m.Components.ProjectList.FilterState() != list.Filtering {
+		return m.toggleFavorite()
+	}
+	if currentState == StateAccounts && m.Components.AccountList.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "i":
+			if m.Data.Impersonating != "" {
+				return m.confirmImpersonation(m.Data.Impersonating), nil
+			}
+		case "x", "delete", "c":
+			return m.handleAccountKey(msg.String())
+		}
+	}
+	if currentState == StateHierarchy && m.Components.HierarchyList.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "right", "l", "left", "h", " ", "f":
+			return m.handleHierarchyKey(msg.String())
+		}
+	}
+	if currentState == StateConfigurations && m.Components.ConfigurationList.FilterState() != list.Filtering {
+		switch msg.String() {
+		case "n", "r", "x", "delete":
+			return m.handleConfigurationKey(msg.String())
+		}
+	}
+
+	key := msg.String()
+	switch key {
 	case "ctrl+c", "q":
 		if currentState == StateMain || currentState == StateLoading || currentState == StateError {
 			return m, tea.Quit
@@ -193,14 +1000,14 @@ func (m AppModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "up", "k":
 		if currentState == StateMain {
-			m.UI.MainMenuChoice = (m.UI.MainMenuChoice - 1 + 4) % 4
+			m.UI.MainMenuChoice = (m.UI.MainMenuChoice - 1 + len(mainMenu)) % len(mainMenu)
 		} else if currentState == StateConfirming {
 			m.UI.ConfirmationChoice = 0
 		}
 
 	case "down", "j":
 		if currentState == StateMain {
-			m.UI.MainMenuChoice = (m.UI.MainMenuChoice + 1) % 4
+			m.UI.MainMenuChoice = (m.UI.MainMenuChoice + 1) % len(mainMenu)
 		} else if currentState == StateConfirming {
 			m.UI.ConfirmationChoice = 1
 		}
@@ -210,25 +1017,476 @@ func (m AppModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.UI.ConfirmationChoice = 1 - m.UI.ConfirmationChoice
 		}
 
-	case "1", "a":
+	case "enter":
+		return m.handleEnterKey()
+
+	default:
 		if currentState == StateMain {
-			return m.handleMenuChoice(0)
+			for _, item := range mainMenu {
+				if item.Key == key {
+					return m.handleMenuChoice(item.Choice)
+				}
+			}
+			if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= maxFavoriteShortcuts {
+				return m.handleFavoriteShortcut(n - 1)
+			}
+			if n := strings.Index(recentShortcuts, key); len(key) == 1 && n >= 0 {
+				return m.handleRecentShortcut(n)
+			}
 		}
-	case "2", "p":
-		if currentState == StateMain {
-			return m.handleMenuChoice(1)
+	}
+	return m, nil
+}
+
+// handleFavoriteShortcut asks to switch to the n-th favorite project
+func (m AppModel) handleFavoriteShortcut(n int) (tea.Model, tea.Cmd) {
+	if n >= len(m.Settings.Favorites) {
+		return m, nil
+	}
+	projectID := m.Settings.Favorites[n]
+	if projectID == m.Data.ActiveProject {
+		return m, nil
+	}
+	return m.confirmProjectSwitch(TriggerFavoriteSelected, projectID), nil
+}
+
+// recentEntries returns the recent switches listed on the main screen, leaving
+// out the account and project already active
+func (m AppModel) recentEntries() []history.Entry {
+	var entries []history.Entry
+	for _, entry := range m.Data.History.Recent(len(recentShortcuts) + 1) {
+		if entry.Account == m.Data.ActiveAccount && (entry.Project == "" || entry.Project == m.Data.ActiveProject) {
+			continue
 		}
-	case "3", "l":
-		if currentState == StateMain {
-			return m.handleMenuChoice(2)
+		entries = append(entries, entry)
+	}
+	return entries[:min(len(entries), len(recentShortcuts))]
+}
+
+// handleRecentShortcut asks to switch back to the n-th recent account and project
+func (m AppModel) handleRecentShortcut(n int) (tea.Model, tea.Cmd) {
+	entries := m.recentEntries()
+	if n >= len(entries) {
+		return m, nil
+	}
+	entry := entries[n]
+	switch {
+	case entry.Account == m.Data.ActiveAccount:
+		return m.confirmProjectSwitch(TriggerRecentSelected, entry.Project), nil
+	case entry.Project != "":
+		return m.confirmSwitch(TriggerRecentSelected, PendingAction{
+			Kind:    ActionSwitchAccountProject,
+			Target:  entry.Project,
+			Options: ActionOptions{Account: entry.Account},
+			Prompt:  fmt.Sprintf("Switch to account %s and project %s?", entry.Account, entry.Project),
+		}), nil
+	}
+	m.StateMachine.Fire(TriggerRecentSelected, m.accountSwitch(entry.Account))
+	return m, nil
+}
+
+// accountSwitch returns the action switching to an account, which also
+// returns to the project last used with it
+func (m AppModel) accountSwitch(account string) PendingAction {
+	prompt := fmt.Sprintf("Switch to account %s?", account)
+	if projectID, ok := m.restorableProject(account); ok {
+		prompt = fmt.Sprintf("Switch to account %s and back to project %s?", account, projectID)
+	}
+	return PendingAction{Kind: ActionSwitchAccount, Target: account, Prompt: prompt}
+}
+
+// confirmProjectSwitch asks to switch to a project. Projects matching a
+// protection rule must have their ID typed to confirm.
+func (m AppModel) confirmProjectSwitch(trigger AppTrigger, projectID string) AppModel {
+	return m.confirmSwitch(trigger, PendingAction{
+		Kind:   ActionSwitchProject,
+		Target: projectID,
+		Prompt: fmt.Sprintf("Switch to project %s?", projectID),
+	})
+}
+
+// confirmSwitch asks to confirm an action switching to the target project,
+// requiring the project ID to be typed when the project is protected
+func (m AppModel) confirmSwitch(trigger AppTrigger, action PendingAction) AppModel {
+	isProjectSwitch := action.Kind == ActionSwitchProject || action.Kind == ActionSwitchAccountProject
+	if location, ok := m.projectLocation(action.Target); ok && isProjectSwitch {
+		// The remembered location is set in the same operation, so its failure is reported
+		action.Options.Region = location.Region
+		action.Options.Zone = location.Zone
+	}
+	if _, ok := m.protectionRule(action.Target); ok || m.protectionUnknown(action.Target) != "" {
+		action.Confirm = ConfirmTyped
+		m.UI.ConfirmMismatch = false
+		m.Components.ConfirmInput.SetValue("")
+		m.Components.ConfirmInput.Focus()
+	}
+	m.StateMachine.Fire(trigger, action)
+	return m
+}
+
+// restorableProject returns the project last used with an account, which an
+// account switch returns to unless the picker is always wanted
+func (m AppModel) restorableProject(account string) (string, bool) {
+	if m.Settings.PickProject {
+		return "", false
+	}
+	return m.Data.History.LastProject(account)
+}
+
+// restoreProject asks to switch back to the project last used with the
+// account just switched to. Unprotected projects are restored without asking.
+func (m *AppModel) restoreProject() tea.Cmd {
+	projectID := m.UI.RestoreProject
+	m.UI.RestoreProject = ""
+	*m = m.confirmProjectSwitch(TriggerRestoreProject, projectID)
+	if m.StateMachine.CanFire(TriggerConfirmYes) {
+		m.StateMachine.Fire(TriggerConfirmYes)
+		return m.StateMachine.GetActionCommand(m.Gcloud)
+	}
+	return nil
+}
+
+// switchedContext returns the account and project an operation switched to,
+// which the effective values are verified against
+func switchedContext(pending PendingAction, kind types.ResultKind) gcp.Context {
+	switch kind {
+	case types.ResultProjectSwitched:
+		return gcp.Context{Account: pending.Options.Account, Project: pending.Target}
+	case types.ResultProfileApplied:
+		return pending.Options.Profile
+	}
+	return gcp.Context{}
+}
+
+// protectionRule returns the rule protecting a project, if any. Labels and
+// folders are only known for projects in the project list.
+func (m AppModel) protectionRule(projectID string) (userconfig.ProtectionRule, bool) {
+	if projectID == "" {
+		return userconfig.ProtectionRule{}, false
+	}
+	project, _ := m.findProject(projectID)
+	return m.Settings.Protection(project, hierarchy.Ancestors(m.Data.Folders, project))
+}
+
+// findProject looks a project up in the project list, then in the projects
+// of every account. Projects found in neither have no labels or parent.
+func (m AppModel) findProject(projectID string) (types.Project, bool) {
+	isProject := func(p types.Project) bool { return p.ProjectID == projectID }
+	if i := slices.IndexFunc(m.Data.Projects, isProject); i >= 0 {
+		return m.Data.Projects[i], true
+	}
+	for _, result := range m.Data.AllProjects {
+		if i := slices.IndexFunc(result.Projects, isProject); i >= 0 {
+			return result.Projects[i], true
 		}
-	case "4", "m":
-		if currentState == StateMain {
-			return m.handleMenuChoice(3)
+	}
+	return types.Project{ProjectID: projectID}, false
+}
+
+// protectionUnknown returns why the protection of a project cannot be
+// decided yet, or "" when the protection rules can be evaluated
+func (m AppModel) protectionUnknown(projectID string) string {
+	if projectID == "" {
+		return ""
+	}
+	if _, ok := m.findProject(projectID); !ok && m.Settings.HasDetailProtection() {
+		return "labels and folder unknown"
+	}
+	if m.Settings.HasFolderProtection() && !m.StateMachine.GetContext().HasHierarchy {
+		return "folders not loaded yet"
+	}
+	return ""
+}
+
+// requestHierarchy lists the organization tree the first time a folder
+// protection rule has to be evaluated
+func (m *AppModel) requestHierarchy() tea.Cmd {
+	if m.Data.ActiveProject == "" || !m.Settings.HasFolderProtection() ||
+		m.StateMachine.GetContext().HasHierarchy || m.Data.HierarchyLoading {
+		return nil
+	}
+	m.Data.HierarchyLoading = true
+	return loadHierarchy(m.Gcloud)
+}
+
+// handleTypedConfirmationKey handles keyboard input while the ID of a protected project is typed
+func (m AppModel) handleTypedConfirmationKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.Components.ConfirmInput.Blur()
+		m.StateMachine.Fire(TriggerConfirmNo)
+	case "enter":
+		m.StateMachine.SetConfirmTyped(strings.TrimSpace(m.Components.ConfirmInput.Value()))
+		if !m.StateMachine.CanFire(TriggerConfirmYes) {
+			m.UI.ConfirmMismatch = true
+			return m, nil
+		}
+		m.Components.ConfirmInput.Blur()
+		m.StateMachine.Fire(TriggerConfirmYes)
+		return m, m.StateMachine.GetActionCommand(m.Gcloud)
+	}
+	return m, nil
+}
+
+// toggleFavorite stars or unstars the selected project and persists the change
+func (m AppModel) toggleFavorite() (tea.Model, tea.Cmd) {
+	selectedItem, ok := m.Components.ProjectList.SelectedItem().(types.Item)
+	if !ok {
+		return m, nil
+	}
+	projectID := selectedItem.ID()
+	m.Settings.ToggleFavorite(projectID)
+	m.updateProjectList()
+	return m, func() tea.Msg {
+		if err := userconfig.Update(func(c *userconfig.Config) { c.ToggleFavorite(projectID) }); err != nil {
+			return types.SettingsSavedMsg{Err: fmt.Errorf("failed to save favorites: %w", err)}
+		}
+		return types.SettingsSavedMsg{}
+	}
+}
+
+// handleHierarchyKey handles the expand, collapse and focus keys of the organization tree
+func (m AppModel) handleHierarchyKey(key string) (tea.Model, tea.Cmd) {
+	selectedItem, ok := m.Components.HierarchyList.SelectedItem().(types.Item)
+	if !ok {
+		return m, nil
+	}
+	path := hierarchy.Path(m.Data.Hierarchy, selectedItem.ID())
+	if len(path) == 0 {
+		return m, nil
+	}
+	node := path[len(path)-1]
+
+	switch key {
+	case "right", "l":
+		if node.IsContainer() {
+			m.UI.Expanded[node.ID] = true
+		}
+	case " ":
+		if node.IsContainer() {
+			m.UI.Expanded[node.ID] = !m.UI.Expanded[node.ID]
+		}
+	case "left", "h":
+		// Collapse the folder, or the folder containing the selection
+		if node.IsContainer() && m.UI.Expanded[node.ID] {
+			m.UI.Expanded[node.ID] = false
+		} else if len(path) > 1 {
+			m.UI.Expanded[path[len(path)-2].ID] = false
+			m.selectHierarchyItem(path[len(path)-2].ID)
+		}
+	case "f":
+		// Narrow the tree to everything under the selected folder, or widen it back
+		if m.UI.HierarchyFocus != "" {
+			m.UI.HierarchyFocus = ""
+		} else if node.IsContainer() {
+			m.UI.HierarchyFocus = node.ID
+		}
+	}
+	m.updateHierarchyList()
+	return m, nil
+}
+
+// handleConfigurationKey handles the create, rename and delete keys of the configuration list
+func (m AppModel) handleConfigurationKey(key string) (tea.Model, tea.Cmd) {
+	if key == "n" {
+		m.UI.RenamingConfiguration = ""
+		m.Components.ConfigurationInput.SetValue("")
+		m.Components.ConfigurationInput.Focus()
+		m.StateMachine.Fire(TriggerEditConfigurationName)
+		return m, nil
+	}
+
+	selectedItem, ok := m.Components.ConfigurationList.SelectedItem().(types.Item)
+	if !ok {
+		return m, nil
+	}
+
+	switch key {
+	case "r":
+		m.UI.RenamingConfiguration = selectedItem.ID()
+		m.Components.ConfigurationInput.SetValue(selectedItem.ID())
+		m.Components.ConfigurationInput.Focus()
+		m.StateMachine.Fire(TriggerEditConfigurationName)
+	case "x", "delete":
+		m.StateMachine.Fire(TriggerConfigurationSelected, PendingAction{
+			Kind:   ActionDeleteConfiguration,
+			Target: selectedItem.ID(),
+			Prompt: fmt.Sprintf("Delete configuration %s?", selectedItem.ID()),
+		})
+	}
+	return m, nil
+}
+
+// handleConfigurationNameKey handles keyboard input while a configuration name is being typed
+func (m AppModel) handleConfigurationNameKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.Components.ConfigurationInput.Blur()
+		m.StateMachine.Fire(TriggerGoBack)
+	case "enter":
+		name := strings.TrimSpace(m.Components.ConfigurationInput.Value())
+		if name == "" || name == m.UI.RenamingConfiguration {
+			return m, nil
+		}
+		m.Components.ConfigurationInput.Blur()
+		if m.UI.RenamingConfiguration != "" {
+			m.StateMachine.Fire(TriggerConfigurationNamed, PendingAction{
+				Kind:    ActionRenameConfiguration,
+				Target:  m.UI.RenamingConfiguration,
+				Options: ActionOptions{NewName: name},
+				Prompt:  fmt.Sprintf("Rename configuration %s to %s?", m.UI.RenamingConfiguration, name),
+			})
+		} else {
+			m.StateMachine.Fire(TriggerConfigurationNamed, PendingAction{
+				Kind:   ActionCreateConfiguration,
+				Target: name,
+				Prompt: fmt.Sprintf("Create and activate configuration %s?", name),
+			})
+		}
+	}
+	return m, nil
+}
+
+// handleADCKey handles the login, revoke and quota project keys of the ADC screen
+func (m AppModel) handleADCKey(key string) (tea.Model, tea.Cmd) {
+	switch key {
+	case "l":
+		m.StateMachine.Fire(TriggerADCAction, PendingAction{
+			Kind:    ActionADCLogin,
+			Options: ActionOptions{Login: m.loginOptions()},
+			Prompt:  "Log in to Application Default Credentials?",
+		})
+	case "x":
+		if m.Data.ADC.Type == "" || m.Data.ADC.FromEnv {
+			// gcloud only revokes the credentials it wrote itself
+			return m, nil
+		}
+		text := "Revoke the Application Default Credentials?"
+		if m.Data.ADC.Account != "" {
+			text = fmt.Sprintf("Revoke the Application Default Credentials of %s?", m.Data.ADC.Account)
+		}
+		m.StateMachine.Fire(TriggerADCAction, PendingAction{Kind: ActionRevokeADC, Prompt: text})
+	case "p":
+		if m.Data.ADC.Type == "" {
+			return m, nil
 		}
+		quotaProject := m.Data.ADC.QuotaProject
+		if quotaProject == "" {
+			quotaProject = m.Data.ActiveProject
+		}
+		m.Components.QuotaInput.SetValue(quotaProject)
+		m.Components.QuotaInput.Focus()
+		m.StateMachine.Fire(TriggerEditQuotaProject)
+	}
+	return m, nil
+}
 
+// handleQuotaProjectKey handles keyboard input while the ADC quota project is being typed
+func (m AppModel) handleQuotaProjectKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.Components.QuotaInput.Blur()
+		m.StateMachine.Fire(TriggerGoBack)
 	case "enter":
-		return m.handleEnterKey()
+		projectID := strings.TrimSpace(m.Components.QuotaInput.Value())
+		if projectID == "" || projectID == m.Data.ADC.QuotaProject {
+			return m, nil
+		}
+		m.Components.QuotaInput.Blur()
+		m.StateMachine.Fire(TriggerQuotaProjectEntered, PendingAction{
+			Kind:   ActionSetQuotaProject,
+			Target: projectID,
+			Prompt: fmt.Sprintf("Bill API calls made with Application Default Credentials to project %s?", projectID),
+		})
+	}
+	return m, nil
+}
+
+// handleAccountKey handles the revoke and clean up keys of the account list
+func (m AppModel) handleAccountKey(key string) (tea.Model, tea.Cmd) {
+	if key == "c" {
+		accounts := make([]string, len(m.Data.Accounts))
+		for i, account := range m.Data.Accounts {
+			accounts[i] = account.Account
+		}
+		m.UI.CheckingAccounts = true
+		m.UI.AccountCheckErr = nil
+		m.UI.InvalidAccounts = nil
+		m.StateMachine.Fire(TriggerCleanup)
+		return m, gcp.CheckAccountTokens(m.Gcloud, accounts)
+	}
+
+	selectedItem, ok := m.Components.AccountList.SelectedItem().(types.Item)
+	if !ok || slices.Contains(m.impersonationTargets(), selectedItem.ID()) {
+		// Impersonation targets hold no credentials of their own
+		return m, nil
+	}
+	m.StateMachine.Fire(TriggerRevokeAccount, PendingAction{
+		Kind:   ActionRevokeCredential,
+		Target: selectedItem.ID(),
+		Prompt: fmt.Sprintf("Revoke account %s and remove its credentials from gcloud?", selectedItem.ID()),
+	})
+	return m, nil
+}
+
+// handleCredentialKey handles the add and revoke keys of the credential inventory
+func (m AppModel) handleCredentialKey(key string) (tea.Model, tea.Cmd) {
+	if key == "n" {
+		m.UI.KeyFileErr = nil
+		m.Components.KeyFileInput.SetValue("")
+		m.Components.KeyFileInput.Focus()
+		m.StateMachine.Fire(TriggerEditKeyFile)
+		return m, nil
+	}
+
+	selectedItem, ok := m.Components.CredentialList.SelectedItem().(types.Item)
+	if !ok {
+		return m, nil
+	}
+	m.StateMachine.Fire(TriggerCredentialAction, PendingAction{
+		Kind:   ActionRevokeCredential,
+		Target: selectedItem.ID(),
+		Prompt: fmt.Sprintf("Revoke the credentials of %s and remove them from gcloud?", selectedItem.ID()),
+	})
+	return m, nil
+}
+
+// handleKeyFileKey handles keyboard input while a key file path is being typed
+func (m AppModel) handleKeyFileKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.Components.KeyFileInput.Blur()
+		m.StateMachine.Fire(TriggerGoBack)
+	case "enter":
+		keyFile := strings.TrimSpace(m.Components.KeyFileInput.Value())
+		if keyFile == "" {
+			return m, nil
+		}
+		if rest, ok := strings.CutPrefix(keyFile, "~/"); ok {
+			if home, err := os.UserHomeDir(); err == nil {
+				keyFile = filepath.Join(home, rest)
+			}
+		}
+		serviceAccount, err := gcp.ReadKeyFile(keyFile)
+		if err != nil {
+			m.UI.KeyFileErr = err
+			return m, nil
+		}
+		m.UI.KeyFileErr = nil
+		m.Components.KeyFileInput.Blur()
+		m.StateMachine.Fire(TriggerKeyFileEntered, PendingAction{
+			Kind:   ActionActivateServiceAccount,
+			Target: keyFile,
+			Prompt: fmt.Sprintf("Activate service account %s? It becomes the active account.", serviceAccount),
+		})
 	}
 	return m, nil
 }
@@ -242,32 +1500,116 @@ func (m AppModel) handleEnterKey() (tea.Model, tea.Cmd) {
 		return m.handleMenuChoice(m.UI.MainMenuChoice)
 
 	case StateAccounts:
-		if len(m.Data.Accounts) > 0 {
-			selectedItem := m.Components.AccountList.SelectedItem().(types.Item)
-			m.StateMachine.SetSelectedID(selectedItem.ID())
-			m.StateMachine.Fire(TriggerAccountSelected, fmt.Sprintf("Switch to account %s?", selectedItem.ID()))
+		selectedItem, ok := m.Components.AccountList.SelectedItem().(types.Item)
+		if !ok {
+			break
 		}
+		if slices.Contains(m.impersonationTargets(), selectedItem.ID()) {
+			m = m.confirmImpersonation(selectedItem.ID())
+			break
+		}
+		m.StateMachine.Fire(TriggerAccountSelected, m.accountSwitch(selectedItem.ID()))
 
 	case StateProjects:
 		if len(m.Data.Projects) > 0 {
 			selectedItem := m.Components.ProjectList.SelectedItem().(types.Item)
 			if selectedItem.ID() != m.Data.ActiveProject {
-				m.StateMachine.SetSelectedID(selectedItem.ID())
-				m.StateMachine.Fire(TriggerProjectSelected, fmt.Sprintf("Switch to project %s?", selectedItem.ID()))
+				m = m.confirmProjectSwitch(TriggerProjectSelected, selectedItem.ID())
+			}
+		}
+
+	case StateHierarchy:
+		selectedItem, ok := m.Components.HierarchyList.SelectedItem().(types.Item)
+		if !ok {
+			break
+		}
+		node := hierarchy.Find(m.Data.Hierarchy, selectedItem.ID())
+		if node != nil && node.IsContainer() {
+			return m.handleHierarchyKey(" ")
+		}
+		if selectedItem.ID() != m.Data.ActiveProject {
+			m = m.confirmProjectSwitch(TriggerProjectSelected, selectedItem.ID())
+		}
+
+	case StateProfiles:
+		selectedItem, ok := m.Components.ProfileList.SelectedItem().(types.Item)
+		if !ok {
+			break
+		}
+		if i := slices.IndexFunc(m.Settings.Profiles, func(p userconfig.Profile) bool { return p.Name == selectedItem.ID() }); i >= 0 {
+			m = m.confirmProfile(m.Settings.Profiles[i])
+		}
+
+	case StateAllProjects:
+		selectedItem, ok := m.Components.AllProjectsList.SelectedItem().(types.Item)
+		if !ok {
+			break
+		}
+		projectID, account, _ := strings.Cut(selectedItem.ID(), "/")
+		switch {
+		case account != m.Data.ActiveAccount:
+			m = m.confirmSwitch(TriggerProjectSelected, PendingAction{
+				Kind:    ActionSwitchAccountProject,
+				Target:  projectID,
+				Options: ActionOptions{Account: account},
+				Prompt:  fmt.Sprintf("Switch to account %s and project %s?", account, projectID),
+			})
+		case projectID != m.Data.ActiveProject:
+			m = m.confirmProjectSwitch(TriggerProjectSelected, projectID)
+		}
+
+	case StateRegions:
+		if selectedItem, ok := m.Components.RegionList.SelectedItem().(types.Item); ok {
+			m.updateZoneList(selectedItem.ID())
+			m.StateMachine.Fire(TriggerRegionSelected)
+		}
+
+	case StateZones:
+		if selectedItem, ok := m.Components.ZoneList.SelectedItem().(types.Item); ok {
+			region, zone := m.UI.SelectedRegion, selectedItem.ID()
+			text := fmt.Sprintf("Set region %s and zone %s?", region, zone)
+			if zone == "" {
+				text = fmt.Sprintf("Set region %s and clear the default zone?", region)
 			}
+			m.StateMachine.Fire(TriggerLocationSelected, PendingAction{
+				Kind:    ActionSetLocation,
+				Target:  region,
+				Options: ActionOptions{Zone: zone},
+				Prompt:  text,
+			})
+		}
+
+	case StateCleanup:
+		if targets := m.UI.InvalidAccounts; len(targets) > 0 {
+			m.StateMachine.Fire(TriggerRevokeAccount, PendingAction{
+				Kind:    ActionRevokeAccounts,
+				Targets: targets,
+				Prompt:  fmt.Sprintf("Revoke %s, whose credentials no longer work?", strings.Join(targets, ", ")),
+			})
 		}
 
 	case StateManualProject:
 		projectID := m.Components.ProjectInput.Value()
 		if projectID != "" && projectID != m.Data.ActiveProject {
-			m.StateMachine.SetSelectedID(projectID)
-			m.StateMachine.Fire(TriggerManualProjectEntry, fmt.Sprintf("Switch to project %s?", projectID))
+			m = m.confirmProjectSwitch(TriggerManualProjectEntry, projectID)
+		}
+
+	case StateConfigurations:
+		if len(m.Data.Configurations) > 0 {
+			selectedItem := m.Components.ConfigurationList.SelectedItem().(types.Item)
+			if selectedItem.ID() != m.Data.ActiveConfiguration {
+				m.StateMachine.Fire(TriggerConfigurationSelected, PendingAction{
+					Kind:   ActionActivateConfiguration,
+					Target: selectedItem.ID(),
+					Prompt: fmt.Sprintf("Activate configuration %s?", selectedItem.ID()),
+				})
+			}
 		}
 
 	case StateConfirming:
 		if m.UI.ConfirmationChoice == 0 { // Yes
 			m.StateMachine.Fire(TriggerConfirmYes)
-			return m, m.StateMachine.GetActionCommand()
+			return m, m.StateMachine.GetActionCommand(m.Gcloud)
 		} else {
 			m.StateMachine.Fire(TriggerConfirmNo)
 		}
@@ -288,25 +1630,80 @@ func (m AppModel) handleMenuChoice(choice int) (tea.Model, tea.Cmd) {
 
 	var cmd tea.Cmd
 	switch choice {
-	case 0: // Accounts
+	case MenuAccounts:
 		if m.StateMachine.CanFire(TriggerLoadAccounts) {
 			m.StateMachine.Fire(TriggerLoadAccounts, LoadingAccounts)
-			cmd = m.StateMachine.GetLoadCommand()
+			cmd = m.StateMachine.GetLoadCommand(m.Gcloud)
 		} else {
 			m.StateMachine.Fire(TriggerMenuChoice)
 		}
-	case 1: // Projects
+	case MenuProjects:
 		if m.StateMachine.CanFire(TriggerLoadProjects) {
 			m.StateMachine.Fire(TriggerLoadProjects, LoadingProjects)
-			cmd = m.StateMachine.GetLoadCommand()
+			cmd = m.StateMachine.GetLoadCommand(m.Gcloud)
 		} else {
 			m.StateMachine.Fire(TriggerMenuChoice)
 		}
-	case 2: // New Login
-		m.StateMachine.Fire(TriggerMenuChoice, "Would you like to login to a new GCP account?")
-	case 3: // Manual Project
+	case MenuLogin:
+		prompt := "Would you like to login to a new GCP account?"
+		if !m.Settings.Login.SkipADC {
+			prompt = "Would you like to login to a new GCP account and its Application Default Credentials?"
+		}
+		m.StateMachine.Fire(TriggerMenuChoice, PendingAction{
+			Kind:    ActionLogin,
+			Options: ActionOptions{Login: m.loginOptions()},
+			Prompt:  prompt,
+		})
+	case MenuManualProject:
 		m.StateMachine.Fire(TriggerMenuChoice)
 		m.Components.ProjectInput.Focus()
+	case MenuConfigurations:
+		if m.StateMachine.CanFire(TriggerLoadConfigurations) {
+			m.StateMachine.Fire(TriggerLoadConfigurations, LoadingConfigurations)
+			cmd = m.StateMachine.GetLoadCommand(m.Gcloud)
+		} else {
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+	case MenuHierarchy:
+		if m.StateMachine.CanFire(TriggerLoadHierarchy) {
+			m.StateMachine.Fire(TriggerLoadHierarchy, LoadingHierarchy)
+			cmd = m.StateMachine.GetLoadCommand(m.Gcloud)
+		} else {
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+	case MenuLocation:
+		if m.StateMachine.CanFire(TriggerLoadLocations) {
+			m.StateMachine.Fire(TriggerLoadLocations, LoadingLocations)
+			cmd = m.StateMachine.GetLoadCommand(m.Gcloud)
+		} else {
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+	case MenuCredentials:
+		if m.StateMachine.CanFire(TriggerLoadCredentials) {
+			m.StateMachine.Fire(TriggerLoadCredentials, LoadingCredentials)
+			cmd = m.StateMachine.GetLoadCommand(m.Gcloud)
+		} else {
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+	case MenuAllProjects:
+		if m.StateMachine.CanFire(TriggerLoadAllProjects) {
+			var accounts []string
+			for _, account := range m.Data.Accounts {
+				accounts = append(accounts, account.Account)
+			}
+			m.StateMachine.Fire(TriggerLoadAllProjects, LoadingAllProjects)
+			cmd = searchProjects(m.Gcloud, accounts, m.Settings.CacheMaxAge())
+		} else {
+			m.updateAllProjectsList() // The active account and project may have changed
+			m.StateMachine.Fire(TriggerMenuChoice)
+		}
+	case MenuProfiles:
+		m.updateProfileList()
+		m.StateMachine.Fire(TriggerMenuChoice)
+	case MenuADC:
+		// Credentials change outside the switcher, so they are read again on every visit
+		m.StateMachine.Fire(TriggerMenuChoice)
+		cmd = gcp.GetADC(m.Gcloud)
 	}
 	return m, cmd
 }
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/cache"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
+	"github.com/mathd/gcp-switcher/types"
+	"github.com/mathd/gcp-switcher/ui"
+)
+
+func TestUpdateInitialLoad(t *testing.T) {
+	m, _ := newTestModel(t)
+
+	if m.Data.ActiveAccount != "alice@example.com" {
+		t.Errorf("Expected active account alice@example.com, got %q", m.Data.ActiveAccount)
+	}
+	if m.Data.ActiveProject != "alpha-123" {
+		t.Errorf("Expected active project alpha-123, got %q", m.Data.ActiveProject)
+	}
+
+	view := m.View()
+	for _, want := range []string{"alice@example.com", "alpha-123", "default", "View/Switch Accounts"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected main view to contain %q", want)
+		}
+	}
+}
+
+func TestUpdateReadsConfigurationFiles(t *testing.T) {
+	runner := newFakeRunner(t)
+	t.Setenv("CLOUDSDK_CONFIG", "gcloudconfig/testdata/sdk")
+
+	m := loadedModel(t, runner)
+	if m.Data.ActiveAccount != "bob@example.com" || m.Data.ActiveProject != "beta-456" {
+		t.Errorf("Expected values from the configuration files, got %q / %q", m.Data.ActiveAccount, m.Data.ActiveProject)
+	}
+	if runner.Called("config", "get-value", "project") {
+		t.Error("Expected the active project to be read without spawning gcloud")
+	}
+}
+
+func TestUpdateGcloudMissing(t *testing.T) {
+	runner := newFakeRunner(t)
+	runner.Missing = true
+
+	m := InitialModel(ui.NewStyles(), runner, userconfig.Config{})
+	m = send(m, gcp.CheckGcloud(runner)())
+
+	if m.StateMachine.GetState() != StateError {
+		t.Fatalf("Expected StateError, got %v", m.StateMachine.GetState())
+	}
+	if !strings.Contains(m.View(), "not installed") {
+		t.Error("Expected error view to explain gcloud is missing")
+	}
+}
+
+func TestUpdateStartsFromCache(t *testing.T) {
+	runner := newFakeRunner(t)
+	t.Setenv("CLOUDSDK_CONFIG", "gcloudconfig/testdata/sdk")
+	now := time.Now()
+	cache.Update(func(c *cache.Cache) {
+		c.SetAccounts([]types.Account{{Account: "bob@example.com", Status: "ACTIVE"}}, now)
+		c.SetProjects("bob@example.com", []types.Project{{ProjectID: "cached-1", Name: "Cached"}}, now.Add(-time.Hour))
+	})
+
+	m := InitialModel(ui.NewStyles(), runner, userconfig.Config{})
+	m = send(m, tea.WindowSizeMsg{Width: 100, Height: 40})
+	var refresh tea.Cmd
+	for _, cmd := range startupCommands(runner) {
+		msg := cmd()
+		next, followUp := m.Update(msg)
+		m = next.(AppModel)
+		if _, ok := msg.(types.ProjectListMsg); ok {
+			refresh = followUp
+		}
+	}
+
+	// The main screen renders from the cache and the configuration files
+	// before gcloud runs at all
+	if m.StateMachine.GetState() != StateMain {
+		t.Fatalf("Expected StateMain from cached lists, got %v", m.StateMachine.GetState())
+	}
+	if calls := runner.Calls(); len(calls) != 0 {
+		t.Errorf("Expected no gcloud call before the refresh, got %v", calls)
+	}
+	if len(m.Data.Configurations) != 2 || m.Data.ActiveConfiguration != "work" {
+		t.Errorf("Expected the configurations read from disk with work active, got %+v", m.Data.Configurations)
+	}
+	if m.Data.Projects[0].ProjectID != "cached-1" {
+		t.Errorf("Expected the cached projects, got %v", m.Data.Projects)
+	}
+	if !strings.Contains(m.View(), "refreshing…") {
+		t.Error("Expected the main view to show that stale lists are refreshing")
+	}
+
+	// Only the stale project list is refreshed
+	for _, msg := range runCmd(refresh) {
+		m = send(m, msg)
+	}
+	if runner.Called("auth", "list", "--format=json") {
+		t.Error("Expected the fresh account list not to be refreshed")
+	}
+	if len(m.Data.Projects) != 2 || m.Data.ProjectsSource != (ListSource{}) {
+		t.Errorf("Expected the refreshed projects to replace the cache, got %v (%+v)", m.Data.Projects, m.Data.ProjectsSource)
+	}
+	if strings.Contains(m.View(), "refreshing") {
+		t.Error("Expected the refreshing indicator to clear")
+	}
+}
+
+func TestUpdateExportMode(t *testing.T) {
+	runner := newFakeRunner(t)
+	t.Setenv(gcp.EnvProject, "")
+
+	m := InitialModel(ui.NewStyles(), runner, userconfig.Config{SwitchMode: userconfig.ModeExport, Shell: "fish"})
+	for _, cmd := range []tea.Cmd{
+		gcp.CheckGcloud(runner),
+		gcp.GetActiveAccount(runner),
+		gcp.GetActiveProject(runner),
+		gcp.GetAllAccounts(runner),
+		gcp.GetSimpleProjects(runner),
+		gcp.GetConfigurations(runner),
+	} {
+		m = send(m, cmd())
+	}
+	if !strings.Contains(m.View(), "Export mode") {
+		t.Error("Expected main view to indicate export mode")
+	}
+
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = next.(AppModel)
+	msgs := runCmd(cmd)
+	if len(msgs) != 1 {
+		t.Fatalf("Expected a single result message, got %v", msgs)
+	}
+
+	next, cmd = m.Update(msgs[0])
+	m = next.(AppModel)
+	if !slices.ContainsFunc(runCmd(cmd), func(msg tea.Msg) bool { _, ok := msg.(tea.QuitMsg); return ok }) {
+		t.Error("Expected the program to quit after exporting a project")
+	}
+	if runner.Called("config", "set", "project", "beta-456") {
+		t.Error("Expected gcloud's global configuration to be left untouched")
+	}
+	if got := m.ExportScript(); got != "set -gx CLOUDSDK_CORE_PROJECT 'beta-456';\n" {
+		t.Errorf("Unexpected export script %q", got)
+	}
+
+	// An exported account applies to the gcloud commands that follow, without
+	// touching the process environment
+	runner.Respond("bob@example.com\n", "auth", "list", "--filter=account:bob@example.com", "--format=value(account)")
+	m = InitialModel(ui.NewStyles(), runner, userconfig.Config{SwitchMode: userconfig.ModeExport, Shell: "fish"})
+	for _, cmd := range startupCommands(runner) {
+		m = send(m, cmd())
+	}
+	m = pressKey(m, "a")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+
+	if env := runner.CallEnv("projects", "list", "--format=json"); env[gcp.EnvAccount] != "bob@example.com" {
+		t.Errorf("Expected the projects of the exported account to be listed, got env %v", env)
+	}
+	if value := os.Getenv(gcp.EnvAccount); value != "" {
+		t.Errorf("Expected the process environment to be left alone, got %s=%s", gcp.EnvAccount, value)
+	}
+}
+
+func TestUpdateDetectsDrift(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.
+		Respond("", "config", "set", "project", "beta-456").
+		Respond("alice@example.com\n", "config", "get-value", "account")
+
+	// A project exported in the shell keeps winning after the switch
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "alpha-123")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "gamma-789")
+	m = pressKey(m, "p")
+	m = pressKey(m, "down")
+	m = pressKey(m, "enter")
+	m = pressKey(m, "enter")
+
+	if m.StateMachine.GetState() != StateMain {
+		t.Fatalf("Expected StateMain after switching, got %v", m.StateMachine.GetState())
+	}
+	var variables []string
+	for _, drift := range m.Data.Drift {
+		variables = append(variables, drift.Variable)
+	}
+	if !slices.Equal(variables, []string{"CLOUDSDK_CORE_PROJECT", "GOOGLE_CLOUD_PROJECT"}) {
+		t.Fatalf("Expected both project variables to be reported, got %+v", m.Data.Drift)
+	}
+	view := m.View()
+	for _, want := range []string{"gcloud uses project alpha-123, not beta-456", "unset CLOUDSDK_CORE_PROJECT GOOGLE_CLOUD_PROJECT"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected the main screen to warn %q, got:\n%s", want, view)
+		}
+	}
+
+	// Once the shell agrees, the warning goes away
+	t.Setenv("CLOUDSDK_CORE_PROJECT", "")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "beta-456")
+	runner.Respond("beta-456\n", "config", "get-value", "project")
+	m = send(m, gcp.VerifySwitch(runner, gcp.Context{Project: "beta-456"})())
+	if len(m.Data.Drift) != 0 || strings.Contains(m.View(), "OVERRIDDEN") {
+		t.Errorf("Expected no drift once the environment matches, got %+v", m.Data.Drift)
+	}
+}
+
+func TestUpdateCredentialsDrift(t *testing.T) {
+	m, runner := newTestModel(t)
+	runner.Respond("alice@example.com\n", "config", "get-value", "account")
+	dir := t.TempDir()
+	verify := func(credentials string) []types.Drift {
+		t.Helper()
+		path := filepath.Join(dir, "credentials.json")
+		if err := os.WriteFile(path, []byte(credentials), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+		m = send(m, gcp.VerifySwitch(runner, gcp.Context{Account: "alice@example.com"})())
+		return m.Data.Drift
+	}
+
+	// Credentials acting as the switched account are not drift
+	if drift := verify(`{"type":"authorized_user","account":"alice@example.com"}`); len(drift) != 0 {
+		t.Errorf("Expected no drift for credentials of the same account, got %+v", drift)
+	}
+	// Nor are credentials whose identity the file does not record
+	if drift := verify(`{"type":"authorized_user"}`); len(drift) != 0 {
+		t.Errorf("Expected no drift for credentials of an unknown identity, got %+v", drift)
+	}
+
+	drift := verify(`{"type":"service_account","client_email":"ci@alpha-123.iam.gserviceaccount.com"}`)
+	if len(drift) != 1 || drift[0].Variable != "GOOGLE_APPLICATION_CREDENTIALS" {
+		t.Fatalf("Expected the service account credentials to be reported, got %+v", drift)
+	}
+	if !strings.Contains(m.View(), "authenticate as ci@alpha-123.iam.gserviceaccount.com, not alice@example.com") {
+		t.Errorf("Expected the main screen to name both identities:\n%s", m.View())
+	}
+}
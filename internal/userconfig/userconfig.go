@@ -0,0 +1,427 @@
+// Package userconfig loads and saves the gcp-switcher user settings file.
+package userconfig
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mathd/gcp-switcher/internal/atomicfile"
+	"github.com/mathd/gcp-switcher/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Switch modes
+const (
+	// ModeGlobal applies switches with gcloud config set, affecting every shell
+	ModeGlobal = "global"
+	// ModeExport prints environment exports for the calling shell instead
+	ModeExport = "export"
+)
+
+// Config holds the user settings stored in config.yaml
+type Config struct {
+	// SwitchMode is either ModeGlobal (the default) or ModeExport
+	SwitchMode string `yaml:"switch_mode,omitempty"`
+	// Shell selects the export syntax; detected from $SHELL when empty
+	Shell string `yaml:"shell,omitempty"`
+	// Favorites lists starred project IDs in the order they were starred
+	Favorites []string `yaml:"favorites,omitempty"`
+	// CacheTTL is how long cached lists are used without a refresh, e.g.
+	// "10m"; DefaultCacheTTL when empty
+	CacheTTL string `yaml:"cache_ttl,omitempty"`
+	// Protected lists the rules marking projects that need typed confirmation
+	Protected []ProtectionRule `yaml:"protected,omitempty"`
+	// ProjectLocations remembers the region and zone last chosen for each
+	// project, applied again whenever the project is switched to
+	ProjectLocations map[string]Location `yaml:"project_locations,omitempty"`
+	// Impersonation lists, per project ID, the service accounts offered in
+	// the account list for impersonation
+	Impersonation map[string][]string `yaml:"impersonation,omitempty"`
+	// Login tunes the interactive gcloud login flows
+	Login Login `yaml:"login,omitempty"`
+	// PickProject opens the project picker after every account switch
+	// instead of returning to the project last used with the account
+	PickProject bool `yaml:"pick_project,omitempty"`
+	// Profiles are named contexts applied in one operation from the
+	// profile picker, listed in this order
+	Profiles []Profile `yaml:"profiles,omitempty"`
+}
+
+// Profile bundles everything switched together for one context, e.g.
+// payments-staging. Region, zone and impersonate are unset when left out;
+// the quota project of the Application Default Credentials is only changed
+// when given.
+type Profile struct {
+	Name         string `yaml:"name"`
+	Account      string `yaml:"account"`
+	Project      string `yaml:"project"`
+	Region       string `yaml:"region,omitempty"`
+	Zone         string `yaml:"zone,omitempty"`
+	Impersonate  string `yaml:"impersonate,omitempty"`
+	QuotaProject string `yaml:"quota_project,omitempty"`
+}
+
+// Browser settings for logins
+const (
+	// BrowserNone completes the login on another machine that has a browser
+	// and gcloud, for sessions over SSH
+	BrowserNone = "none"
+	// BrowserManual prints a URL to open in any browser and asks for the
+	// verification code
+	BrowserManual = "manual"
+)
+
+// Login tunes the interactive gcloud login flows
+type Login struct {
+	// Browser is empty to open a local browser, BrowserNone or BrowserManual
+	Browser string `yaml:"browser,omitempty"`
+	// SkipADC skips the Application Default Credentials login that follows
+	// logging in to a new account
+	SkipADC bool `yaml:"skip_adc,omitempty"`
+}
+
+// Flags returns the gcloud login flags for the browser setting
+func (l Login) Flags() []string {
+	switch l.Browser {
+	case BrowserNone:
+		return []string{"--no-browser"}
+	case BrowserManual:
+		return []string{"--no-launch-browser"}
+	}
+	return nil
+}
+
+// Location is a default compute region and zone
+type Location struct {
+	Region string `yaml:"region"`
+	Zone   string `yaml:"zone,omitempty"`
+}
+
+// SetProjectLocation remembers the region and zone chosen for a project
+func (c *Config) SetProjectLocation(projectID string, location Location) {
+	if c.ProjectLocations == nil {
+		c.ProjectLocations = map[string]Location{}
+	}
+	c.ProjectLocations[projectID] = location
+}
+
+// ProtectionRule marks projects by exactly one of a label, a project ID glob
+// or a folder
+type ProtectionRule struct {
+	// Label is key=value, or just key to match any value
+	Label string `yaml:"label,omitempty"`
+	// Project is a glob such as *-prod, in path.Match syntax
+	Project string `yaml:"project,omitempty"`
+	// Folder is a folder ID; every project beneath the folder matches
+	Folder string `yaml:"folder,omitempty"`
+}
+
+// String describes the rule, e.g. "label env=prod"
+func (r ProtectionRule) String() string {
+	switch {
+	case r.Label != "":
+		return "label " + r.Label
+	case r.Project != "":
+		return "project " + r.Project
+	default:
+		return "folder " + r.Folder
+	}
+}
+
+// Matches reports whether the rule protects a project. Ancestors lists the
+// resource names of the folders and organization containing the project.
+func (r ProtectionRule) Matches(project types.Project, ancestors []string) bool {
+	switch {
+	case r.Label != "":
+		key, value, hasValue := strings.Cut(r.Label, "=")
+		actual, ok := project.Labels[key]
+		return ok && (!hasValue || actual == value)
+	case r.Project != "":
+		matched, _ := path.Match(r.Project, project.ProjectID)
+		return matched
+	case r.Folder != "":
+		return slices.Contains(ancestors, "folders/"+strings.TrimPrefix(r.Folder, "folders/"))
+	}
+	return false
+}
+
+// Protection returns the first rule protecting a project
+func (c Config) Protection(project types.Project, ancestors []string) (ProtectionRule, bool) {
+	for _, rule := range c.Protected {
+		if rule.Matches(project, ancestors) {
+			return rule, true
+		}
+	}
+	return ProtectionRule{}, false
+}
+
+// HasFolderProtection reports whether any rule needs the folder tree to be evaluated
+func (c Config) HasFolderProtection() bool {
+	return slices.ContainsFunc(c.Protected, func(r ProtectionRule) bool { return r.Folder != "" })
+}
+
+// HasDetailProtection reports whether any rule matches on labels or folders,
+// which are only known for projects that have been listed
+func (c Config) HasDetailProtection() bool {
+	return slices.ContainsFunc(c.Protected, func(r ProtectionRule) bool { return r.Label != "" || r.Folder != "" })
+}
+
+// DefaultCacheTTL is used when the settings file does not set cache_ttl
+const DefaultCacheTTL = 5 * time.Minute
+
+// ExportMode reports whether switches should be printed as shell exports
+func (c Config) ExportMode() bool {
+	return c.SwitchMode == ModeExport
+}
+
+// CacheMaxAge returns how long cached lists are used without a refresh
+func (c Config) CacheMaxAge() time.Duration {
+	if ttl, err := time.ParseDuration(c.CacheTTL); err == nil {
+		return ttl
+	}
+	return DefaultCacheTTL
+}
+
+// Dir returns the gcp-switcher configuration directory. It honors
+// GCP_SWITCHER_CONFIG_DIR, then the platform user configuration directory.
+func Dir() (string, error) {
+	if dir := os.Getenv("GCP_SWITCHER_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gcp-switcher"), nil
+}
+
+// Path returns the location of config.yaml
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load reads the settings file. A missing file yields the default settings.
+func Load() (Config, error) {
+	path, err := Path()
+	if err != nil {
+		return Config{}, err
+	}
+	data, err := atomicfile.Read(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return parse(path, data)
+}
+
+// parse decodes and validates the content of the settings file at path
+func parse(path string, data []byte) (Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return config, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Update applies a change to the settings file and writes it back. Only the
+// file content is changed, so command line overrides are never persisted.
+func Update(change func(c *Config)) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	return atomicfile.Update(path, func(data []byte) ([]byte, error) {
+		config, err := parse(path, data)
+		if err != nil {
+			return nil, err
+		}
+		// Encoded before the change, which may modify maps and slices in place
+		var before yaml.Node
+		if err := before.Encode(config); err != nil {
+			return nil, err
+		}
+		change(&config)
+		return edit(data, &before, config)
+	})
+}
+
+// edit rewrites only the top-level settings that differ between before and
+// after in the settings file content data. Everything else, comments, order
+// and layout included, is kept as the user wrote it.
+func edit(data []byte, before *yaml.Node, after Config) ([]byte, error) {
+	var updated yaml.Node
+	if err := updated.Encode(after); err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var root *yaml.Node
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+		if root.Kind != yaml.MappingNode || root.Style&yaml.FlowStyle != 0 {
+			// Only block mappings can be edited line by line
+			return yaml.Marshal(after)
+		}
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+	// Keys are edited bottom up so that line numbers stay valid
+	written := map[string]bool{}
+	if root != nil {
+		for i := len(root.Content) - 2; i >= 0; i -= 2 {
+			key := root.Content[i].Value
+			written[key] = true
+			value := mappingValue(&updated, key)
+			if equalNodes(mappingValue(before, key), value) {
+				continue
+			}
+			end := len(lines)
+			if i+2 < len(root.Content) {
+				end = root.Content[i+2].Line - 1
+			}
+			start, end := root.Content[i].Line-1, settingEnd(lines, root.Content[i].Line, end)
+			var replacement []string
+			if value != nil {
+				text, err := marshalSetting(key, value)
+				if err != nil {
+					return nil, err
+				}
+				replacement = []string{text}
+			}
+			lines = slices.Concat(lines[:start], replacement, lines[end:])
+		}
+	}
+	for i := 0; i < len(updated.Content); i += 2 {
+		key := updated.Content[i].Value
+		if written[key] {
+			continue
+		}
+		text, err := marshalSetting(key, updated.Content[i+1])
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, text)
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// settingEnd returns the index of the line after a top-level setting that
+// starts on line start and runs at most up to index limit. Blank and comment
+// lines at its end are left in place, as they usually introduce the next
+// setting.
+func settingEnd(lines []string, start, limit int) int {
+	end := limit
+	for end > start {
+		line := strings.TrimSpace(lines[end-1])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// equalNodes reports whether two nodes encode to the same YAML
+func equalNodes(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	encodedA, errA := yaml.Marshal(a)
+	encodedB, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+// marshalSetting encodes one top-level setting
+func marshalSetting(key string, value *yaml.Node) (string, error) {
+	data, err := yaml.Marshal(&yaml.Node{
+		Kind:    yaml.MappingNode,
+		Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: key}, value},
+	})
+	return string(data), err
+}
+
+// IsFavorite reports whether a project is starred
+func (c Config) IsFavorite(projectID string) bool {
+	return slices.Contains(c.Favorites, projectID)
+}
+
+// ToggleFavorite stars or unstars a project
+func (c *Config) ToggleFavorite(projectID string) {
+	if i := slices.Index(c.Favorites, projectID); i >= 0 {
+		c.Favorites = slices.Delete(c.Favorites, i, i+1)
+		return
+	}
+	c.Favorites = append(c.Favorites, projectID)
+}
+
+// validate checks values that cannot be corrected silently
+func (c Config) validate() error {
+	switch c.SwitchMode {
+	case "", ModeGlobal, ModeExport:
+	default:
+		return fmt.Errorf("switch_mode must be %q or %q, got %q", ModeGlobal, ModeExport, c.SwitchMode)
+	}
+	for i, rule := range c.Protected {
+		set := 0
+		for _, field := range []string{rule.Label, rule.Project, rule.Folder} {
+			if field != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("protected rule %d must set exactly one of label, project or folder", i+1)
+		}
+		if _, err := path.Match(rule.Project, ""); err != nil {
+			return fmt.Errorf("protected rule %d has an invalid project pattern %q", i+1, rule.Project)
+		}
+	}
+	switch c.Login.Browser {
+	case "", BrowserNone, BrowserManual:
+	default:
+		return fmt.Errorf("login.browser must be %q or %q, got %q", BrowserNone, BrowserManual, c.Login.Browser)
+	}
+	names := map[string]bool{}
+	for i, profile := range c.Profiles {
+		if profile.Name == "" || profile.Account == "" || profile.Project == "" {
+			return fmt.Errorf("profile %d must set name, account and project", i+1)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("profile name %q is used more than once", profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	if c.CacheTTL != "" {
+		if ttl, err := time.ParseDuration(c.CacheTTL); err != nil || ttl < 0 {
+			return fmt.Errorf("cache_ttl must be a duration such as 10m, got %q", c.CacheTTL)
+		}
+	}
+	return nil
+}
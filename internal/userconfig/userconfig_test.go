@@ -0,0 +1,165 @@
+package userconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", t.TempDir())
+
+	config, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if config.ExportMode() || config.CacheMaxAge() != DefaultCacheTTL || len(config.Favorites) != 0 {
+		t.Errorf("Expected the default settings, got %+v", config)
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", t.TempDir())
+
+	err := Update(func(c *Config) {
+		c.SwitchMode = ModeExport
+		c.ToggleFavorite("alpha-123")
+		c.SetProjectLocation("alpha-123", Location{Region: "europe-west1", Zone: "europe-west1-b"})
+		c.Profiles = []Profile{{Name: "client", Account: "bob@example.com", Project: "beta-456"}}
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := Update(func(c *Config) { c.ToggleFavorite("beta-456") }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	config, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !config.ExportMode() || !config.IsFavorite("alpha-123") || !config.IsFavorite("beta-456") {
+		t.Errorf("Expected both updates to be kept, got %+v", config)
+	}
+	if location := config.ProjectLocations["alpha-123"]; location.Zone != "europe-west1-b" {
+		t.Errorf("Expected the remembered location, got %+v", location)
+	}
+	if len(config.Profiles) != 1 || config.Profiles[0].Name != "client" {
+		t.Errorf("Expected the profile, got %+v", config.Profiles)
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", t.TempDir())
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := Update(func(c *Config) { c.ToggleFavorite(fmt.Sprintf("project-%d", i)) }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	config, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(config.Favorites) != 20 {
+		t.Errorf("Expected no update to be lost, got %d favorites", len(config.Favorites))
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, tc := range []struct{ name, yaml, want string }{
+		{"switch mode", "switch_mode: local\n", "switch_mode"},
+		{"protection rule", "protected:\n  - label: env=prod\n    project: '*-prod'\n", "exactly one"},
+		{"project pattern", "protected:\n  - project: '[prod'\n", "invalid project pattern"},
+		{"browser", "login:\n  browser: chrome\n", "login.browser"},
+		{"profile", "profiles:\n  - name: client\n    account: bob@example.com\n", "must set name, account and project"},
+		{"profile name", "profiles:\n  - {name: a, account: x, project: p}\n  - {name: a, account: y, project: q}\n", "more than once"},
+		{"cache ttl", "cache_ttl: soon\n", "cache_ttl"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("GCP_SWITCHER_CONFIG_DIR", dir)
+			if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(tc.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tc.want, err)
+			}
+			if err := Update(func(c *Config) {}); err == nil {
+				t.Error("Expected Update to refuse to overwrite an invalid file")
+			}
+		})
+	}
+}
+
+func TestUpdateKeepsLayout(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GCP_SWITCHER_CONFIG_DIR", dir)
+	const original = `# Settings for gcp-switcher
+switch_mode: export  # for the prompt
+
+# Starred by hand
+favorites:
+  - alpha-123
+
+protected:
+  - label: env=prod
+pick_project: false
+`
+	file := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(file, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() string {
+		t.Helper()
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := Update(func(c *Config) { c.ToggleFavorite("beta-456") }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	want := strings.Replace(original, "  - alpha-123\n", "    - alpha-123\n    - beta-456\n", 1)
+	if got := read(); got != want {
+		t.Errorf("Expected only the favorites to change, got:\n%s", got)
+	}
+
+	// New settings are appended and emptied ones removed
+	err := Update(func(c *Config) {
+		c.Favorites = nil
+		c.SetProjectLocation("alpha-123", Location{Region: "europe-west1"})
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	want = `# Settings for gcp-switcher
+switch_mode: export  # for the prompt
+
+# Starred by hand
+
+protected:
+  - label: env=prod
+pick_project: false
+project_locations:
+    alpha-123:
+        region: europe-west1
+`
+	if got := read(); got != want {
+		t.Errorf("Expected the favorites removed and the location appended, got:\n%s", got)
+	}
+}
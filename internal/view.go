@@ -2,6 +2,12 @@ package internal
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mathd/gcp-switcher/cmd/gcp"
+	"github.com/mathd/gcp-switcher/internal/pin"
+	"github.com/mathd/gcp-switcher/types"
 )
 
 // View renders the current application state
@@ -27,6 +33,16 @@ func (m AppModel) View() string {
 			loadingText = "Loading Accounts..."
 		case LoadingProjects:
 			loadingText = "Loading Projects..."
+		case LoadingConfigurations:
+			loadingText = "Loading Configurations..."
+		case LoadingHierarchy:
+			loadingText = "Loading Organizations and Folders..."
+		case LoadingLocations:
+			loadingText = "Loading Regions and Zones..."
+		case LoadingCredentials:
+			loadingText = "Loading Credentials..."
+		case LoadingAllProjects:
+			loadingText = fmt.Sprintf("Searching the projects of %d accounts...", len(m.Data.Accounts))
 		}
 
 		if stateContext.LoadingContext != LoadingInitial {
@@ -47,33 +63,70 @@ func (m AppModel) View() string {
 
 		// Account and project info
 		accountInfo := fmt.Sprintf("Active Account: %s", m.UI.Styles.Highlight.Render(m.Data.ActiveAccount))
+		if m.Data.Impersonating != "" {
+			accountInfo = fmt.Sprintf("Acting As: %s via %s",
+				m.UI.Styles.Highlight.Render(m.Data.Impersonating), m.UI.Styles.Highlight.Render(m.Data.ActiveAccount))
+		}
 		projectInfo := fmt.Sprintf("Active Project: %s", m.UI.Styles.Highlight.Render(m.Data.ActiveProject))
-		s += accountInfo + "\n" + projectInfo + "\n\n"
+		s += accountInfo + "\n" + projectInfo + "\n"
+		if m.Data.ActiveConfiguration != "" {
+			s += fmt.Sprintf("Configuration: %s", m.UI.Styles.Highlight.Render(m.Data.ActiveConfiguration)) + "\n"
+		}
+		if m.Data.ActiveRegion != "" || m.Data.ActiveZone != "" {
+			s += fmt.Sprintf("Region/Zone: %s", m.UI.Styles.Highlight.Render(orUnset(m.Data.ActiveRegion)+" / "+orUnset(m.Data.ActiveZone))) + "\n"
+		}
+		if status := cacheStatus(m.Data.AccountsSource, m.Data.ProjectsSource); status != "" {
+			s += m.UI.Styles.Info.Render("Lists "+status) + "\n"
+		}
+		s += "\n"
+		if rule, ok := m.protectionRule(m.Data.ActiveProject); ok {
+			s += m.UI.Styles.Warning.Render("⚠ PROTECTED PROJECT ("+rule.String()+")") + "\n\n"
+		}
+		s += m.driftWarning()
+		if warning := m.adcMismatch(); warning != "" {
+			s += m.UI.Styles.Error.Render(warning) + "\n\n"
+		}
+		if m.UI.SaveErr != nil {
+			s += m.UI.Styles.Error.Render(m.UI.SaveErr.Error()) + "\n\n"
+		}
+		s += m.pinBanner()
 
 		// Menu options
 		s += m.UI.Styles.Subtitle.Render("What would you like to do?") + "\n\n"
-		menuItems := []string{
-			" View/Switch Accounts ",
-			" View/Switch Projects ",
-			" Login to a New Account ",
-			" Enter Project ID Manually ",
-		}
-		for i, item := range menuItems {
+		for i, item := range mainMenu {
 			buttonStyle := m.UI.Styles.BlurredButton
 			if i == m.UI.MainMenuChoice {
 				buttonStyle = m.UI.Styles.FocusedButton
 			}
-			s += fmt.Sprintf("%d. %s\n", i+1, buttonStyle.Render(item))
+			s += fmt.Sprintf("%s. %s\n", item.Key, buttonStyle.Render(item.Label))
+		}
+		s += m.favoritesSection()
+		s += m.recentSection()
+		if m.Settings.ExportMode() {
+			s += "\n" + m.UI.Styles.Subtitle.Render("Export mode: switches apply to the calling shell only")
 		}
-		s += "\n" + m.UI.Styles.Info.Render("Press q to quit, ↑/↓ to navigate, Enter to select")
+		s += "\n" + m.UI.Styles.Info.Render("Press q to quit, ↑/↓ to navigate, Enter to select, 1-9 for favorites, v-z for recent")
 
 	case StateAccounts:
 		s = m.Components.AccountList.View()
-		s += "\n" + m.UI.Styles.Info.Render("Press Enter to select, q to go back")
+		if status := cacheStatus(m.Data.AccountsSource); status != "" {
+			s += "\n" + m.UI.Styles.Info.Render("Accounts "+status)
+		}
+		help := "Press Enter to select, x to revoke, c to clean up, q to go back"
+		if m.Data.Impersonating != "" {
+			help = "Press Enter to select, i to stop impersonating, x to revoke, c to clean up, q to go back"
+		}
+		s += "\n" + m.UI.Styles.Info.Render(help)
 
 	case StateProjects:
 		s = m.Components.ProjectList.View()
-		s += "\n" + m.UI.Styles.Info.Render("Press Enter to select, q to go back")
+		if status := cacheStatus(m.Data.ProjectsSource); status != "" {
+			s += "\n" + m.UI.Styles.Info.Render("Projects "+status)
+		}
+		if m.UI.SaveErr != nil {
+			s += "\n" + m.UI.Styles.Error.Render(m.UI.SaveErr.Error())
+		}
+		s += "\n" + m.UI.Styles.Info.Render("Press Enter to select, s to star, / to filter (env:prod matches labels), q to go back")
 
 	case StateManualProject:
 		s = m.UI.Styles.Title.Render("Enter Project ID") + "\n\n"
@@ -81,8 +134,113 @@ func (m AppModel) View() string {
 		s += m.Components.ProjectInput.View() + "\n\n"
 		s += m.UI.Styles.Info.Render("Press Enter to confirm, q to go back")
 
+	case StateHierarchy:
+		s = m.Components.HierarchyList.View()
+		if m.Data.HierarchyErr != nil {
+			s += "\n" + m.UI.Styles.Error.Render("Organization tree is incomplete: "+m.Data.HierarchyErr.Error())
+		}
+		help := "Press Enter to switch or expand, ←/→ to collapse/expand, f to show everything under a folder, q to go back"
+		if m.UI.HierarchyFocus != "" {
+			help = "Press Enter to switch, / to filter, f to show the whole tree, q to go back"
+		}
+		s += "\n" + m.UI.Styles.Info.Render(help)
+
+	case StateRegions:
+		s = m.Components.RegionList.View()
+		if status := cacheStatus(m.Data.LocationsSource); status != "" {
+			s += "\n" + m.UI.Styles.Info.Render("Regions "+status)
+		}
+		s += "\n" + m.UI.Styles.Info.Render("Press Enter to pick a zone, / to filter, q to go back")
+
+	case StateZones:
+		s = m.Components.ZoneList.View()
+		s += "\n" + m.UI.Styles.Info.Render("Press Enter to select, q to go back to regions")
+
+	case StateADC:
+		s = m.UI.Styles.Title.Render("Application Default Credentials") + "\n\n"
+		s += m.adcDetails()
+		s += "\n" + m.UI.Styles.Info.Render("Press l to log in again, x to revoke, p to set the quota project, q to go back")
+
+	case StateCleanup:
+		s = m.UI.Styles.Title.Render("Clean Up Accounts") + "\n\n"
+		targets := m.UI.InvalidAccounts
+		switch {
+		case m.UI.CheckingAccounts:
+			s += fmt.Sprintf("Checking the credentials of %d accounts...\n\n", len(m.Data.Accounts))
+			s += m.UI.Styles.Info.Render("Press q to go back")
+		case m.UI.AccountCheckErr != nil:
+			s += m.UI.Styles.Error.Render(m.UI.AccountCheckErr.Error()) + "\n\n"
+			s += m.UI.Styles.Info.Render("Press q to go back")
+		case len(targets) == 0:
+			s += "Every account has working credentials.\n\n"
+			s += m.UI.Styles.Info.Render("Press q to go back")
+		default:
+			s += "These accounts can no longer get an access token:\n\n"
+			for _, account := range targets {
+				s += "  ✗ " + account + "\n"
+			}
+			s += "\n" + m.UI.Styles.Info.Render("Press Enter to revoke them all, q to go back")
+		}
+
+	case StateCredentials:
+		s = m.Components.CredentialList.View()
+		s += "\n" + m.UI.Styles.Info.Render("Press n to add a service account key, x to revoke, q to go back")
+
+	case StateProfiles:
+		if len(m.Settings.Profiles) == 0 {
+			s = m.UI.Styles.Title.Render("Profiles") + "\n\n"
+			s += "No profiles are defined yet. Add them under profiles in config.yaml.\n\n"
+			s += m.UI.Styles.Info.Render("Press q to go back")
+			break
+		}
+		s = m.Components.ProfileList.View()
+		s += "\n" + m.UI.Styles.Info.Render("Press Enter to switch to the profile, q to go back")
+
+	case StateAllProjects:
+		s = m.Components.AllProjectsList.View()
+		for _, result := range m.Data.AllProjects {
+			if result.Err != nil {
+				s += "\n" + m.UI.Styles.Error.Render(fmt.Sprintf("Projects of %s could not be listed", result.Account))
+			}
+		}
+		s += "\n" + m.UI.Styles.Info.Render("Press Enter to switch to the account and project, / to filter, q to go back")
+
+	case StateKeyFile:
+		s = m.UI.Styles.Title.Render("Add Service Account") + "\n\n"
+		s += "Please enter the path of the service account's JSON key file:\n\n"
+		s += m.Components.KeyFileInput.View() + "\n\n"
+		if m.UI.KeyFileErr != nil {
+			s += m.UI.Styles.Error.Render(m.UI.KeyFileErr.Error()) + "\n\n"
+		}
+		s += m.UI.Styles.Info.Render("Press Enter to confirm, Esc to go back")
+
+	case StateQuotaProject:
+		s = m.UI.Styles.Title.Render("Set Quota Project") + "\n\n"
+		s += "Please enter the project billed for API calls made with Application Default Credentials:\n\n"
+		s += m.Components.QuotaInput.View() + "\n\n"
+		s += m.UI.Styles.Info.Render("Press Enter to confirm, Esc to go back")
+
+	case StateConfigurations:
+		s = m.Components.ConfigurationList.View()
+		s += "\n" + m.UI.Styles.Info.Render("Press Enter to activate, n to create, r to rename, x to delete, q to go back")
+
+	case StateConfigurationName:
+		if m.UI.RenamingConfiguration != "" {
+			s = m.UI.Styles.Title.Render("Rename Configuration") + "\n\n"
+			s += fmt.Sprintf("Please enter a new name for configuration %s:\n\n", m.UI.RenamingConfiguration)
+		} else {
+			s = m.UI.Styles.Title.Render("Create Configuration") + "\n\n"
+			s += "Please enter a name for the new configuration:\n\n"
+		}
+		s += m.Components.ConfigurationInput.View() + "\n\n"
+		s += m.UI.Styles.Info.Render("Press Enter to confirm, Esc to go back")
+
 	case StateConfirming:
 		s = m.UI.Styles.Title.Render("Confirmation") + "\n\n"
+		if stateContext.Pending.Confirm == ConfirmTyped {
+			s += m.protectedConfirmation()
+			break
+		}
 		s += m.StateMachine.GetConfirmationText() + "\n\n"
 
 		yesStyle := m.UI.Styles.BlurredButton
@@ -104,5 +262,212 @@ func (m AppModel) View() string {
 		)
 	}
 
+	if _, ok := m.protectionRule(m.Data.ActiveProject); ok {
+		return m.UI.Styles.ProtectedApp.Render(s)
+	}
 	return m.UI.Styles.App.Render(s)
 }
+
+// protectedConfirmation renders the confirmation of a switch to a protected
+// project, which requires typing the project ID
+func (m AppModel) protectedConfirmation() string {
+	projectID := m.StateMachine.GetContext().Pending.Target
+	reason := m.protectionUnknown(projectID)
+	if rule, ok := m.protectionRule(projectID); ok {
+		reason = rule.String()
+	}
+
+	s := m.UI.Styles.Warning.Render("⚠ PROTECTED PROJECT ("+reason+")") + "\n\n"
+	s += m.StateMachine.GetConfirmationText() + "\n\n"
+	s += fmt.Sprintf("Type %s to confirm:\n\n", m.UI.Styles.Highlight.Render(projectID))
+	s += m.Components.ConfirmInput.View() + "\n\n"
+	if m.UI.ConfirmMismatch {
+		s += m.UI.Styles.Error.Render("The project ID does not match") + "\n\n"
+	}
+	s += m.UI.Styles.Info.Render("Press Enter to confirm, Esc to cancel")
+	return s
+}
+
+// adcDetails renders the Application Default Credentials and where they come from
+func (m AppModel) adcDetails() string {
+	adc := m.Data.ADC
+	if m.Data.ADCErr != nil {
+		return m.UI.Styles.Error.Render(m.Data.ADCErr.Error()) + "\n"
+	}
+	if adc.Type == "" {
+		s := fmt.Sprintf("Credentials file: %s\n\n", m.UI.Styles.Highlight.Render("none"))
+		return s + "Client libraries will not find credentials until you log in.\n"
+	}
+
+	source := "written by gcloud auth application-default login"
+	if adc.FromEnv {
+		source = "from " + gcp.EnvCredentials
+	}
+	account := adc.Account
+	if account == "" {
+		account = "unknown"
+	}
+
+	s := fmt.Sprintf("Credentials file: %s (%s)\n", m.UI.Styles.Highlight.Render(adc.Path), source)
+	s += fmt.Sprintf("Type: %s\n", m.UI.Styles.Highlight.Render(adc.Type))
+	s += fmt.Sprintf("Identity: %s\n", m.UI.Styles.Highlight.Render(account))
+	s += fmt.Sprintf("Quota project: %s\n", m.UI.Styles.Highlight.Render(orUnset(adc.QuotaProject)))
+	if warning := m.adcMismatch(); warning != "" {
+		s += "\n" + m.UI.Styles.Error.Render(warning) + "\n"
+	}
+	if adc.FromEnv {
+		s += "\n" + m.UI.Styles.Subtitle.Render(gcp.EnvCredentials+" takes precedence: logging in or revoking changes gcloud's file, not this one") + "\n"
+	}
+	return s
+}
+
+// adcMismatch warns when Application Default Credentials act as a different
+// identity than the active gcloud account
+func (m AppModel) adcMismatch() string {
+	adc := m.Data.ADC
+	if adc.Account == "" || m.Data.ActiveAccount == "" || adc.Account == m.Data.ActiveAccount {
+		return ""
+	}
+	return fmt.Sprintf("⚠ Application Default Credentials use %s, gcloud uses %s", adc.Account, m.Data.ActiveAccount)
+}
+
+// driftWarning renders the sources that win over the active account and
+// project, and how to get rid of the environment variables among them
+func (m AppModel) driftWarning() string {
+	if len(m.Data.Drift) == 0 {
+		return ""
+	}
+
+	s := m.UI.Styles.Warning.Render("⚠ OVERRIDDEN: NOT EVERYTHING USES THE VALUES ABOVE") + "\n"
+	var variables []string
+	for _, drift := range m.Data.Drift {
+		s += m.UI.Styles.Error.Render("• "+drift.Message) + "\n"
+		if drift.Variable != "" {
+			variables = append(variables, drift.Variable)
+		}
+	}
+	if len(variables) > 0 {
+		s += m.UI.Styles.Info.Render("Run unset "+strings.Join(variables, " ")+" in your shell to use the gcloud configuration") + "\n"
+	}
+	return s + "\n"
+}
+
+// pinBanner renders the pin file governing the working directory, warning
+// when the active values differ from the pinned ones
+func (m AppModel) pinBanner() string {
+	p := m.Data.Pin
+	if p.Path == "" {
+		return ""
+	}
+	if p.Err != nil {
+		return m.UI.Styles.Error.Render(p.Err.Error()) + "\n\n"
+	}
+
+	var pinned []string
+	for _, value := range []struct{ name, value string }{
+		{"configuration", p.Pin.Configuration},
+		{"account", p.Pin.Account},
+		{"project", p.Pin.Project},
+		{"region", p.Pin.Region},
+	} {
+		if value.value != "" {
+			pinned = append(pinned, value.name+" "+value.value)
+		}
+	}
+	s := m.UI.Styles.Subtitle.Render(fmt.Sprintf("📌 Pinned by %s: %s", p.Path, strings.Join(pinned, ", "))) + "\n"
+
+	active := types.Pin{
+		Configuration: m.Data.ActiveConfiguration,
+		Account:       m.Data.ActiveAccount,
+		Project:       m.Data.ActiveProject,
+		Region:        m.Data.ActiveRegion,
+	}
+	if mismatches := pin.Mismatches(p.Pin, active); len(mismatches) > 0 {
+		s += m.UI.Styles.Error.Render("Active settings differ from the pin: "+strings.Join(mismatches, "; ")) + "\n"
+		s += m.UI.Styles.Info.Render("Run 'gcp-switcher apply' to switch to the pinned values") + "\n"
+	}
+	return s + "\n"
+}
+
+// favoritesSection renders the favorite projects reachable with number keys
+func (m AppModel) favoritesSection() string {
+	if len(m.Settings.Favorites) == 0 {
+		return ""
+	}
+
+	names := map[string]string{}
+	for _, project := range m.Data.Projects {
+		names[project.ProjectID] = project.Name
+	}
+
+	s := "\n" + m.UI.Styles.Subtitle.Render("Favorites") + "\n"
+	for i, projectID := range m.Settings.Favorites[:min(len(m.Settings.Favorites), maxFavoriteShortcuts)] {
+		line := "★ " + projectID
+		if projectID == m.Data.ActiveProject {
+			line = m.UI.Styles.ActiveItem.Render(line + " (ACTIVE)")
+		}
+		if name := names[projectID]; name != "" {
+			line += " " + m.UI.Styles.Info.Render(name)
+		}
+		s += fmt.Sprintf("%d. %s\n", i+1, line)
+	}
+	return s
+}
+
+// recentSection renders the recently used account and project pairs with
+// the keys switching back to them
+func (m AppModel) recentSection() string {
+	entries := m.recentEntries()
+	if len(entries) == 0 {
+		return ""
+	}
+
+	s := "\n" + m.UI.Styles.Subtitle.Render("Recent") + "\n"
+	for i, entry := range entries {
+		target := entry.Account
+		if entry.Project != "" {
+			target += " / " + entry.Project
+		}
+		s += fmt.Sprintf("%c. %s %s\n", recentShortcuts[i], target, m.UI.Styles.Info.Render(formatAge(time.Since(entry.Time))))
+	}
+	return s
+}
+
+// cacheStatus describes lists served from the cache, e.g. "cached 3m ago,
+// refreshing…", or returns an empty string when every list is live
+func cacheStatus(sources ...ListSource) string {
+	var oldest time.Time
+	refreshing := false
+	for _, source := range sources {
+		if source.CachedAt.IsZero() {
+			continue
+		}
+		if oldest.IsZero() || source.CachedAt.Before(oldest) {
+			oldest = source.CachedAt
+		}
+		refreshing = refreshing || source.Refreshing
+	}
+	if oldest.IsZero() {
+		return ""
+	}
+
+	status := "cached " + formatAge(time.Since(oldest))
+	if refreshing {
+		status += ", refreshing…"
+	}
+	return status
+}
+
+// formatAge renders a duration as a short relative time such as "5m ago"
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
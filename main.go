@@ -8,7 +8,11 @@ import (
 	"os"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mathd/gcp-switcher/cmd/gcp"
 	"github.com/mathd/gcp-switcher/internal"
+	"github.com/mathd/gcp-switcher/internal/cli"
+	"github.com/mathd/gcp-switcher/internal/shell"
+	"github.com/mathd/gcp-switcher/internal/userconfig"
 	"github.com/mathd/gcp-switcher/internal/version"
 	"github.com/mathd/gcp-switcher/ui"
 )
@@ -20,6 +24,8 @@ const (
 var (
 	debugMode   bool
 	showVersion bool
+	exportMode  bool
+	shellName   string
 	logger      *log.Logger
 )
 
@@ -44,6 +50,12 @@ func main() {
 	// Parse command line flags
 	flag.BoolVar(&debugMode, "debug", false, "Enable debug logging")
 	flag.BoolVar(&showVersion, "version", false, "Show version information")
+	flag.BoolVar(&exportMode, "export", false, "Print shell exports instead of changing gcloud's global configuration")
+	flag.StringVar(&shellName, "shell", "", "Shell syntax for --export: bash, zsh, fish or powershell (default: detected from $SHELL)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), cli.Usage+"\nFlags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// Show version if requested
@@ -55,18 +67,65 @@ func main() {
 	// Initialize logger
 	initLogger()
 
+	runner := gcp.NewExecRunner()
+
+	// Load user settings; command line flags take precedence
+	settings, err := userconfig.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if exportMode {
+		settings.SwitchMode = userconfig.ModeExport
+	}
+	if shellName != "" {
+		settings.Shell = shellName
+	}
+	if settings.Shell != "" {
+		if _, err := shell.Parse(settings.Shell); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Run a non-interactive subcommand if one was given
+	if flag.NArg() > 0 {
+		logger.Printf("Running subcommand: %v", flag.Args())
+		var options cli.Options
+		if settings.ExportMode() {
+			options.Export = shell.Detect()
+			if settings.Shell != "" {
+				options.Export, _ = shell.Parse(settings.Shell)
+			}
+		}
+		os.Exit(cli.Run(flag.Args(), runner, options, os.Stdout, os.Stderr))
+	}
+
 	logger.Println("Starting GCP Switcher application")
 
 	// Initialize styles
 	styles := ui.NewStyles()
 
+	// In export mode stdout carries the exports for the calling shell to eval,
+	// so the interface is drawn on stderr instead
+	options := []tea.ProgramOption{tea.WithAltScreen()}
+	if settings.ExportMode() {
+		logger.Println("Export mode enabled")
+		options = append(options, tea.WithOutput(os.Stderr))
+	}
+
 	// Create and start the program
-	p := tea.NewProgram(internal.InitialModel(styles), tea.WithAltScreen())
+	p := tea.NewProgram(internal.InitialModel(styles, runner, settings), options...)
 
 	// Start the program
-	if _, err := p.Run(); err != nil {
+	finalModel, err := p.Run()
+	if err != nil {
 		logger.Printf("Error running program: %v", err)
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	if m, ok := finalModel.(internal.AppModel); ok {
+		fmt.Print(m.ExportScript())
+	}
 }
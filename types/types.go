@@ -1,20 +1,136 @@
 package types
 
 import (
+	"path"
+	"time"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
 // Account represents a GCP account
 type Account struct {
-	Account string `json:"account"`
-	Status  string `json:"status"`
+	Account string `json:"account" yaml:"account"`
+	Status  string `json:"status" yaml:"status"`
 }
 
 // Project represents a GCP project
 type Project struct {
-	Name      string `json:"name"`
-	ProjectID string `json:"projectId"`
+	Name           string            `json:"name" yaml:"name"`
+	ProjectID      string            `json:"projectId" yaml:"projectId"`
+	ProjectNumber  string            `json:"projectNumber,omitempty" yaml:"projectNumber,omitempty"`
+	LifecycleState string            `json:"lifecycleState,omitempty" yaml:"lifecycleState,omitempty"`
+	CreateTime     time.Time         `json:"createTime,omitzero" yaml:"createTime,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Parent         *ResourceParent   `json:"parent,omitempty" yaml:"parent,omitempty"`
+}
+
+// AccountProjects is the project list visible to one account
+type AccountProjects struct {
+	Account  string
+	Projects []Project
+	CachedAt time.Time // Set when the list was served from the on-disk cache
+	Err      error     // Why the projects could not be listed
+}
+
+// ResourceParent identifies the organization or folder containing a project
+type ResourceParent struct {
+	Type string `json:"type" yaml:"type"` // "organization" or "folder"
+	ID   string `json:"id" yaml:"id"`
+}
+
+// ResourceName returns the parent as a resource name such as folders/123
+func (p ResourceParent) ResourceName() string {
+	return p.Type + "s/" + p.ID
+}
+
+// Credential types as shown in the credential inventory
+const (
+	CredentialUser           = "user"
+	CredentialServiceAccount = "service_account"
+	CredentialExternal       = "external_account" // Workload identity federation
+)
+
+// Credential is an account gcloud holds credentials for
+type Credential struct {
+	Account string
+	Status  string
+	Type    string // One of the Credential* constants
+}
+
+// Organization represents a GCP organization
+type Organization struct {
+	Name        string `json:"name"` // organizations/<id>
+	DisplayName string `json:"displayName"`
+}
+
+// Folder represents a resource manager folder
+type Folder struct {
+	Name        string `json:"name"` // folders/<id>
+	DisplayName string `json:"displayName"`
+	Parent      string `json:"parent"` // Resource name of the parent folder or organization
+}
+
+// Region represents a Compute Engine region
+type Region struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Zone represents a Compute Engine zone
+type Zone struct {
+	Name   string `json:"name"`
+	Region string `json:"region"` // URL of the region
+	Status string `json:"status"`
+}
+
+// RegionName returns the name of the region containing the zone
+func (z Zone) RegionName() string {
+	return path.Base(z.Region)
+}
+
+// Configuration represents a named gcloud configuration
+type Configuration struct {
+	Name       string                  `json:"name"`
+	IsActive   bool                    `json:"is_active"`
+	Properties ConfigurationProperties `json:"properties"`
+}
+
+// ConfigurationProperties holds the properties set in a configuration
+type ConfigurationProperties struct {
+	Core struct {
+		Account string `json:"account"`
+		Project string `json:"project"`
+	} `json:"core"`
+	Compute struct {
+		Region string `json:"region"`
+		Zone   string `json:"zone"`
+	} `json:"compute"`
+}
+
+// Drift is a source that wins over the account or project gcp-switcher
+// switched to, such as an environment variable set in the calling shell
+type Drift struct {
+	Variable string // Environment variable responsible, if any
+	Message  string // Which source wins and what uses it
+}
+
+// ADC describes the Application Default Credentials that client libraries
+// resolve to. Type is empty when no credentials are set up.
+type ADC struct {
+	Path         string // Credentials file, set even when it does not exist
+	FromEnv      bool   // Path comes from GOOGLE_APPLICATION_CREDENTIALS
+	Type         string // authorized_user, service_account, impersonated_service_account or external_account
+	Account      string // Identity the credentials act as, when known
+	QuotaProject string
+}
+
+// Pin holds the values pinned by a .gcp-switcher.yaml file. Empty fields are not pinned.
+type Pin struct {
+	Account       string `yaml:"account,omitempty"`
+	Project       string `yaml:"project,omitempty"`
+	Region        string `yaml:"region,omitempty"`
+	Configuration string `yaml:"configuration,omitempty"`
 }
 
 // Item represents an item in the list
@@ -45,19 +161,89 @@ func (i Item) Description() string { return i.description }
 func (i Item) FilterValue() string { return i.title + i.description }
 func (i Item) ID() string          { return i.id }
 
+// ResultKind tells what a successful operation changed
+type ResultKind int
+
+const (
+	ResultLoggedIn ResultKind = iota + 1
+	ResultAccountSwitched
+	ResultProjectSwitched
+	ResultConfigurationChanged
+	ResultPropertySet
+	ResultLocationSet
+	ResultADCChanged
+	ResultCredentialsChanged
+	ResultImpersonationSet
+	ResultProfileApplied
+)
+
 // Message Types
 type SpinnerMsg tea.Msg
 type ErrMsg struct{ Err error }
 type GcloudCheckMsg struct{ Available bool }
 type ActiveAccountMsg struct{ Account string }
 type ActiveProjectMsg struct{ Project string }
-type AccountListMsg struct{ Accounts []Account }
-type ProjectListMsg struct{ Projects []Project }
+type AccountListMsg struct {
+	Accounts []Account
+	CachedAt time.Time // Set when the list was served from the on-disk cache
+}
+type ProjectListMsg struct {
+	Projects []Project
+	CachedAt time.Time // Set when the list was served from the on-disk cache
+}
+type ConfigurationListMsg struct{ Configurations []Configuration }
+type LocationListMsg struct {
+	Regions  []Region
+	Zones    []Zone
+	CachedAt time.Time // Set when the lists were served from the on-disk cache
+	Err      error
+}
+type HierarchyMsg struct {
+	Organizations []Organization
+	Folders       []Folder
+	CachedAt      time.Time // Set when the tree was served from the on-disk cache
+	Err           error     // Set when the organizations or folders could not be listed
+}
 type OperationResultMsg struct {
 	Success bool
 	Err     error
-	Message string
+	Kind    ResultKind        // What changed, for successful operations
+	Env     map[string]string // Environment variables to export instead of changing gcloud's configuration
+}
+type CredentialListMsg struct {
+	Credentials []Credential
+	Err         error
+}
+type ProjectSearchMsg struct {
+	Results []AccountProjects // One per account, ordered by account
+}
+type AccountCheckMsg struct {
+	Invalid []string // Accounts whose credentials no longer work
+	Err     error
+}
+type ADCMsg struct {
+	ADC ADC
+	Err error
+}
+type ADCAccountMsg struct {
+	Path    string // Credentials file the identity was looked up for
+	Account string
+	Err     error
 }
 type FallbackTimerMsg struct{ TimeoutSeconds int }
+type PinMsg struct {
+	Pin  Pin
+	Path string // Path of the pin file as shown to the user
+	Err  error
+}
+type VerificationMsg struct {
+	Drift []Drift // Sources winning over the switched account and project
+	Err   error   // Set when the effective values could not be read back
+}
+type PropertyMsg struct {
+	Property string
+	Value    string
+}
+type SettingsSavedMsg struct{ Err error } // Reports whether config.yaml or the history was saved
 
 func (e ErrMsg) Error() string { return e.Err.Error() }
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResourceName(t *testing.T) {
+	for _, tc := range []struct {
+		parent ResourceParent
+		want   string
+	}{
+		{ResourceParent{Type: "folder", ID: "123"}, "folders/123"},
+		{ResourceParent{Type: "organization", ID: "1"}, "organizations/1"},
+	} {
+		if got := tc.parent.ResourceName(); got != tc.want {
+			t.Errorf("Expected %s, got %s", tc.want, got)
+		}
+	}
+}
+
+func TestZoneRegionName(t *testing.T) {
+	zone := Zone{Name: "europe-west1-b", Region: "https://www.googleapis.com/compute/v1/projects/alpha-123/regions/europe-west1"}
+	if got := zone.RegionName(); got != "europe-west1" {
+		t.Errorf("Expected europe-west1, got %s", got)
+	}
+}
+
+func TestItem(t *testing.T) {
+	item := NewItem("alpha-123", "Alpha env:prod", false, "alpha-123")
+	if item.Title() != "alpha-123" || item.ID() != "alpha-123" {
+		t.Errorf("Expected the plain title and the ID, got %q and %q", item.Title(), item.ID())
+	}
+	if item.FilterValue() != "alpha-123Alpha env:prod" {
+		t.Errorf("Expected the title and description to be filtered on, got %q", item.FilterValue())
+	}
+	if active := NewItem("alpha-123", "", true, "alpha-123"); !strings.Contains(active.Title(), "alpha-123 (ACTIVE)") {
+		t.Errorf("Expected the active item to be marked, got %q", active.Title())
+	}
+}
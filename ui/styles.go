@@ -7,6 +7,7 @@ import (
 // Styles defines the UI styling configuration
 type Styles struct {
 	App           lipgloss.Style
+	ProtectedApp  lipgloss.Style // App frame while a protected project is active
 	Title         lipgloss.Style
 	Subtitle      lipgloss.Style
 	Info          lipgloss.Style
@@ -16,6 +17,7 @@ type Styles struct {
 	FocusedButton lipgloss.Style
 	BlurredButton lipgloss.Style
 	ActiveItem    lipgloss.Style
+	Warning       lipgloss.Style // Banner for protected projects
 }
 
 // NewStyles initializes and returns the UI styles
@@ -26,6 +28,11 @@ func NewStyles() Styles {
 			BorderForeground(lipgloss.Color("99")).
 			Padding(1, 2),
 
+		ProtectedApp: lipgloss.NewStyle().
+			BorderStyle(lipgloss.ThickBorder()).
+			BorderForeground(lipgloss.Color("196")).
+			Padding(1, 2),
+
 		Title: lipgloss.NewStyle().
 			Foreground(lipgloss.Color("213")).
 			Bold(true).
@@ -60,5 +67,11 @@ func NewStyles() Styles {
 		ActiveItem: lipgloss.NewStyle().
 			Foreground(lipgloss.Color("159")).
 			Bold(true),
+
+		Warning: lipgloss.NewStyle().
+			Foreground(lipgloss.Color("231")).
+			Background(lipgloss.Color("160")).
+			Padding(0, 1).
+			Bold(true),
 	}
 }